@@ -0,0 +1,119 @@
+package binstruct
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type BitOrder = string
+
+const (
+	// BitOrderMSB packs bitfields starting from the most significant
+	// bit of the storage unit, as used by network protocol headers.
+	BitOrderMSB BitOrder = "msb"
+	// BitOrderLSB packs bitfields starting from the least significant
+	// bit of the storage unit.
+	BitOrderLSB BitOrder = "lsb"
+)
+
+var (
+	ErrOptionBitsInvalid     = errors.New("tag option bits must be within the size of a boolean or integer field")
+	ErrOptionBitOrderInvalid = errors.New("tag option bitorder must be either msb or lsb")
+	ErrBitfieldOverflow      = errors.New("value does not fit within the bitfield")
+)
+
+// bitfieldUnit is the storage shared by consecutive bitfields, the
+// unit is the size of the first field's type and is read or written
+// as a single integer.
+type bitfieldUnit struct {
+	// Size is the size of the unit in bytes.
+	Size int
+	// Used is the number of bits assigned to fields.
+	Used int
+	// Order determines which end of the unit is filled first.
+	Order BitOrder
+	// Fields are the fields packed into the unit in declaration order.
+	Fields []*fieldDefinition
+}
+
+// bitfield describes the position of a field within its unit.
+type bitfield struct {
+	Unit  *bitfieldUnit
+	Shift uint
+	Bits  uint
+}
+
+// First determines whether the field is the first in its unit, the
+// unit is read or written when the first field is reached.
+func (b *bitfield) First(f *fieldDefinition) bool {
+	return b.Unit.Fields[0] == f
+}
+
+// mask returns the bits of the field's value.
+func (b *bitfield) mask() uint64 {
+	return 1<<b.Bits - 1
+}
+
+// packBitfield assigns the field to the unit of the preceding
+// bitfield, or to a new unit when the field doesn't fit.
+func packBitfield(f *fieldDefinition, previous *bitfieldUnit) (*bitfieldUnit, error) {
+	kind := f.Type.Kind()
+	size := kindSize(kind)
+	if size == 0 || kind == reflect.Float32 || kind == reflect.Float64 ||
+		f.Options.Bits < 1 || f.Options.Bits > int64(size*8) {
+		return nil, ErrOptionBitsInvalid
+	}
+	bits := int(f.Options.Bits)
+	unit := previous
+	if unit == nil || unit.Used+bits > unit.Size*8 {
+		unit = &bitfieldUnit{Size: size, Order: f.Options.BitOrder}
+	}
+	f.Bitfield = &bitfield{Unit: unit, Bits: uint(bits)}
+	if unit.Order == BitOrderLSB {
+		f.Bitfield.Shift = uint(unit.Used)
+	} else {
+		f.Bitfield.Shift = uint(unit.Size*8 - unit.Used - bits)
+	}
+	unit.Used += bits
+	unit.Fields = append(unit.Fields, f)
+	return unit, nil
+}
+
+// unpack sets the value from the field's bits within the unit.
+func (b *bitfield) unpack(unit uint64, v reflect.Value) {
+	value := unit >> b.Shift & b.mask()
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(value != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// sign-extend the value from the number of bits
+		shift := 64 - b.Bits
+		v.SetInt(int64(value<<shift) >> shift)
+	default:
+		v.SetUint(value)
+	}
+}
+
+// pack returns the unit with the field's bits set from the value.
+func (b *bitfield) pack(unit uint64, v reflect.Value) (uint64, error) {
+	var value uint64
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			value = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		signed := v.Int()
+		if limit := int64(1) << (b.Bits - 1); b.Bits < 64 && (signed < -limit || signed >= limit) {
+			return 0, ErrBitfieldOverflow
+		}
+		value = uint64(signed) & b.mask()
+	default:
+		value = v.Uint()
+		if value > b.mask() {
+			return 0, ErrBitfieldOverflow
+		}
+	}
+	return unit | value<<b.Shift, nil
+}
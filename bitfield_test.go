@@ -0,0 +1,167 @@
+package binstruct
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type ipv4Header struct {
+	Version        uint8  `binstruct:"bits=4"`
+	IHL            uint8  `binstruct:"bits=4"`
+	DSCP           uint8  `binstruct:"bits=6"`
+	ECN            uint8  `binstruct:"bits=2"`
+	TotalLength    uint16 `binstruct:"endian=big"`
+	Identification uint16 `binstruct:"endian=big"`
+	Reserved       uint16 `binstruct:"bits=1,endian=big"`
+	DontFragment   bool   `binstruct:"bits=1"`
+	MoreFragments  bool   `binstruct:"bits=1"`
+	FragmentOffset uint16 `binstruct:"bits=13"`
+}
+
+func TestParseStructBitfields(t *testing.T) {
+	definition, err := parseStruct(ipv4Header{})
+	assert.NoError(t, err)
+
+	version := definition.Field("Version").Bitfield
+	ihl := definition.Field("IHL").Bitfield
+	dscp := definition.Field("DSCP").Bitfield
+	assert.Equal(t, version.Unit, ihl.Unit)
+	assert.NotEqual(t, version.Unit, dscp.Unit)
+	assert.Equal(t, 1, version.Unit.Size)
+	assert.Equal(t, uint(4), version.Shift)
+	assert.Equal(t, uint(0), ihl.Shift)
+	assert.Nil(t, definition.Field("TotalLength").Bitfield)
+
+	reserved := definition.Field("Reserved").Bitfield
+	offset := definition.Field("FragmentOffset").Bitfield
+	assert.Equal(t, reserved.Unit, offset.Unit)
+	assert.Equal(t, 2, reserved.Unit.Size)
+	assert.Equal(t, uint(15), reserved.Shift)
+	assert.Equal(t, uint(0), offset.Shift)
+}
+
+func TestParseStructInvalidBits(t *testing.T) {
+	tooLarge := struct {
+		A uint8 `binstruct:"bits=9"`
+	}{}
+	_, err := parseStruct(tooLarge)
+	assert.Equal(t, ErrOptionBitsInvalid, err)
+
+	float := struct {
+		A float32 `binstruct:"bits=4"`
+	}{}
+	_, err = parseStruct(float)
+	assert.Equal(t, ErrOptionBitsInvalid, err)
+
+	order := struct {
+		A uint8 `binstruct:"bits=4,bitorder=middle"`
+	}{}
+	_, err = parseStruct(order)
+	assert.Equal(t, ErrOptionBitOrderInvalid, err)
+}
+
+func TestUnmarshalBitfields(t *testing.T) {
+	data := []byte{0x45, 0xB9, 0x00, 0x54, 0x12, 0x34, 0x40, 0x00}
+	var header ipv4Header
+	assert.NoError(t, Unmarshal(data, &header))
+	assert.Equal(t, ipv4Header{
+		Version:        4,
+		IHL:            5,
+		DSCP:           46,
+		ECN:            1,
+		TotalLength:    84,
+		Identification: 0x1234,
+		DontFragment:   true,
+	}, header)
+}
+
+func TestBitfieldsUnitSize(t *testing.T) {
+	type tcpFlags struct {
+		DataOffset uint16 `binstruct:"bits=4,endian=big"`
+		reserved   uint8  `binstruct:"bits=3"`
+		Flags      uint16 `binstruct:"bits=9"`
+		Window     uint16 `binstruct:"endian=big"`
+	}
+	data := []byte{0x50, 0x12, 0xFF, 0xFF}
+	var flags tcpFlags
+	assert.NoError(t, Unmarshal(data, &flags))
+	assert.Equal(t, tcpFlags{DataOffset: 5, Flags: 0x12, Window: 0xFFFF}, flags)
+
+	encoded, err := Marshal(flags)
+	assert.NoError(t, err)
+	assert.Equal(t, data, encoded)
+}
+
+func TestBitfieldsLSB(t *testing.T) {
+	type foo struct {
+		A uint8 `binstruct:"bits=3,bitorder=lsb"`
+		B int8  `binstruct:"bits=5"`
+		C uint8 `binstruct:"bits=7,bitorder=lsb"`
+		D bool  `binstruct:"bits=1"`
+	}
+	data := []byte{0xF5, 0x81}
+	var value foo
+	assert.NoError(t, Unmarshal(data, &value))
+	assert.Equal(t, foo{5, -2, 1, true}, value)
+
+	encoded, err := Marshal(value)
+	assert.NoError(t, err)
+	assert.Equal(t, data, encoded)
+}
+
+func TestMarshalBitfields(t *testing.T) {
+	header := ipv4Header{
+		Version:        4,
+		IHL:            5,
+		DSCP:           46,
+		ECN:            1,
+		TotalLength:    84,
+		Identification: 0x1234,
+		DontFragment:   true,
+		FragmentOffset: 0x10,
+	}
+	data, err := Marshal(header)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x45, 0xB9, 0x00, 0x54, 0x12, 0x34, 0x40, 0x10}, data)
+}
+
+func TestMarshalBitfieldLenField(t *testing.T) {
+	// the unit is rewritten at the position of its first field
+	foo := struct {
+		A uint8  `binstruct:"skip=2,bits=4"`
+		N uint8  `binstruct:"bits=4"`
+		S string `binstruct:"lenfield=N"`
+	}{A: 1, S: "abc"}
+	data, err := Marshal(&foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0x13, 'a', 'b', 'c'}, data)
+}
+
+func TestMarshalBitfieldOverflow(t *testing.T) {
+	_, err := Marshal(ipv4Header{Version: 16})
+	assert.Equal(t, ErrBitfieldOverflow, errors.Cause(err))
+
+	signed := struct {
+		A int8 `binstruct:"bits=4"`
+	}{-9}
+	_, err = Marshal(signed)
+	assert.Equal(t, ErrBitfieldOverflow, errors.Cause(err))
+}
+
+func TestBitfieldsBlankPadding(t *testing.T) {
+	type foo struct {
+		_ uint8 `binstruct:"bits=2"`
+		A uint8 `binstruct:"bits=4"`
+		_ uint8 `binstruct:"bits=2"`
+		B uint8
+	}
+	var value foo
+	assert.NoError(t, Unmarshal([]byte{0xFF, 0x01}, &value))
+	assert.Equal(t, foo{A: 0xF, B: 1}, value)
+
+	data, err := Marshal(value)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x3C, 0x01}, data)
+}
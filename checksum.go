@@ -0,0 +1,257 @@
+package binstruct
+
+import (
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChecksumCRC32 is the IEEE CRC-32 used by zip, gzip and PNG.
+	ChecksumCRC32 = "crc32"
+	// ChecksumCRC32C is the Castagnoli CRC-32.
+	ChecksumCRC32C = "crc32c"
+	// ChecksumAdler32 is the Adler-32 checksum used by zlib.
+	ChecksumAdler32 = "adler32"
+	// ChecksumCRC16CCITT is the CRC-16 with the CCITT polynomial 0x1021
+	// and an initial value of 0xFFFF.
+	ChecksumCRC16CCITT = "crc16ccitt"
+	// ChecksumXOR8 is the XOR of the bytes.
+	ChecksumXOR8 = "xor8"
+	// ChecksumSum8 is the sum of the bytes modulo 2^8.
+	ChecksumSum8 = "sum8"
+	// ChecksumSum16 is the sum of the bytes modulo 2^16.
+	ChecksumSum16 = "sum16"
+	// ChecksumSum32 is the sum of the bytes modulo 2^32.
+	ChecksumSum32 = "sum32"
+)
+
+var (
+	ErrOptionChecksumInvalid = errors.New("tag option checksum must be a registered checksum used with exported integer fields")
+	ErrOptionOverInvalid     = errors.New("tag option over must be a field or range of fields such as Header..Payload, excluding the checksum field")
+	ErrChecksumUnreadable    = errors.New("checksum requires reading back the bytes written, which the writer doesn't support")
+)
+
+// ChecksumFunc computes the checksum of the bytes, the result is
+// truncated to the size of the checksum field.
+type ChecksumFunc func(b []byte) uint64
+
+// ChecksumError is returned when a checksum read doesn't match the
+// checksum computed over the bytes of its range.
+type ChecksumError struct {
+	// Algorithm is the name of the checksum.
+	Algorithm string
+	// Expected is the checksum read from the field.
+	Expected uint64
+	// Actual is the checksum computed over the range.
+	Actual uint64
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch, read %#x but computed %#x", e.Algorithm, e.Expected, e.Actual)
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+var checksums = struct {
+	sync.RWMutex
+	m map[string]ChecksumFunc
+}{m: map[string]ChecksumFunc{
+	ChecksumCRC32: func(b []byte) uint64 {
+		return uint64(crc32.ChecksumIEEE(b))
+	},
+	ChecksumCRC32C: func(b []byte) uint64 {
+		return uint64(crc32.Checksum(b, castagnoliTable))
+	},
+	ChecksumAdler32: func(b []byte) uint64 {
+		return uint64(adler32.Checksum(b))
+	},
+	ChecksumCRC16CCITT: crc16CCITT,
+	ChecksumXOR8: func(b []byte) uint64 {
+		var sum byte
+		for _, c := range b {
+			sum ^= c
+		}
+		return uint64(sum)
+	},
+	ChecksumSum8:  byteSum(8),
+	ChecksumSum16: byteSum(16),
+	ChecksumSum32: byteSum(32),
+}}
+
+// RegisterChecksum registers a checksum algorithm used by the checksum
+// tag option. Checksums must be registered before the structs using
+// them are first marshalled or unmarshalled.
+//
+// RegisterChecksum panics if the name is empty or already registered.
+func RegisterChecksum(name string, fn ChecksumFunc) {
+	if name == "" || fn == nil {
+		panic("binstruct: RegisterChecksum requires a name and a function")
+	}
+	checksums.Lock()
+	defer checksums.Unlock()
+	if _, ok := checksums.m[name]; ok {
+		panic(fmt.Sprintf("binstruct: checksum %s is already registered", name))
+	}
+	checksums.m[name] = fn
+}
+
+// lookupChecksum returns the checksum registered to the name.
+func lookupChecksum(name string) (ChecksumFunc, bool) {
+	checksums.RLock()
+	defer checksums.RUnlock()
+	fn, ok := checksums.m[name]
+	return fn, ok
+}
+
+// crc16CCITT computes the CRC-16 with the polynomial 0x1021 and an
+// initial value of 0xFFFF.
+func crc16CCITT(b []byte) uint64 {
+	crc := uint16(0xFFFF)
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return uint64(crc)
+}
+
+// byteSum returns a checksum of the sum of the bytes modulo 2^bits.
+func byteSum(bits uint) ChecksumFunc {
+	return func(b []byte) uint64 {
+		var sum uint64
+		for _, c := range b {
+			sum += uint64(c)
+		}
+		return sum & (1<<bits - 1)
+	}
+}
+
+// checksumRange is the checksum of a field computed over the bytes of
+// a range of fields belonging to the same struct.
+type checksumRange struct {
+	Algorithm string
+	Func      ChecksumFunc
+	// First and Last are the indexes of the fields at the start and
+	// end of the range.
+	First int
+	Last  int
+}
+
+// resolveChecksum resolves the fields of the checksum's over option,
+// which may follow the checksum field so are resolved once the struct
+// has been parsed.
+func (s *structDefinition) resolveChecksum(f *fieldDefinition) error {
+	names := strings.SplitN(f.Options.Over, "..", 2)
+	if len(names) == 1 {
+		names = append(names, names[0])
+	}
+	indexes := make([]int, 2)
+	for i, name := range names {
+		indexes[i] = s.fieldIndex(name)
+		if indexes[i] < 0 {
+			return &fieldReferenceError{"over", name, ErrOptionOverInvalid}
+		}
+	}
+	index := s.fieldIndex(f.Field.Name)
+	if indexes[0] > indexes[1] || index >= indexes[0] && index <= indexes[1] {
+		return ErrOptionOverInvalid
+	}
+	f.Checksum.First, f.Checksum.Last = indexes[0], indexes[1]
+	return nil
+}
+
+// orderChecksums orders the struct's checksums so those covering other
+// checksum fields are computed after them.
+func (s *structDefinition) orderChecksums() error {
+	ordered := make([]*fieldDefinition, 0, len(s.Checksums))
+	pending := s.Checksums
+	for len(pending) > 0 {
+		var remaining []*fieldDefinition
+		for _, f := range pending {
+			if covers(f, pending) {
+				remaining = append(remaining, f)
+			} else {
+				ordered = append(ordered, f)
+			}
+		}
+		// checksums covering each other can't be computed
+		if len(remaining) == len(pending) {
+			return &fieldReferenceError{"over", remaining[0].Options.Over, ErrOptionOverInvalid}
+		}
+		pending = remaining
+	}
+	s.Checksums = ordered
+	return nil
+}
+
+// covers determines whether the checksum's range includes any of the
+// other checksum fields.
+func covers(f *fieldDefinition, checksums []*fieldDefinition) bool {
+	for _, c := range checksums {
+		if c == f {
+			continue
+		}
+		index := f.Struct.fieldIndex(c.Field.Name)
+		if index >= f.Checksum.First && index <= f.Checksum.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds returns the positions of the bytes covered by the checksum,
+// from the first value to the end of the last value of the fields in
+// the range. Fields without an extent, which weren't written, are
+// ignored.
+func (c *checksumRange) bounds(s *structDefinition, extents map[string]fieldExtent) (int64, int64) {
+	var start, end int64
+	found := false
+	for _, f := range s.Fields[c.First : c.Last+1] {
+		// blank fields share an extent, and lie between the fields
+		// at the ends of the range
+		if f.Field.Name == "_" {
+			continue
+		}
+		extent, ok := extents[f.Field.Name]
+		if !ok {
+			continue
+		}
+		if !found || extent.Value < start {
+			start = extent.Value
+		}
+		if !found || extent.End > end {
+			end = extent.End
+		}
+		found = true
+	}
+	return start, end
+}
+
+// verifyChecksum compares the checksum read by the field with the
+// checksum computed over the bytes of its range.
+func (d *decoder) verifyChecksum(f *fieldDefinition, parent reflect.Value, extents map[string]fieldExtent) error {
+	start, end := f.Checksum.bounds(f.Struct, extents)
+	b, err := d.src.readAt(start, end-start)
+	if err != nil {
+		return err
+	}
+	v := dereference(parent.FieldByIndex(f.Field.Index))
+	mask := uint64(1)<<uint(kindSize(v.Kind())*8) - 1
+	expected := uint64(intValue(v)) & mask
+	actual := f.Checksum.Func(b) & mask
+	if expected != actual {
+		return &ChecksumError{Algorithm: f.Checksum.Algorithm, Expected: expected, Actual: actual}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package binstruct
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type checksumChunk struct {
+	Length uint32 `binstruct:"endian=big"`
+	Type   [4]byte
+	Data   []byte `binstruct:"lenfield=Length"`
+	CRC    uint32 `binstruct:"endian=big,checksum=crc32,over=Type..Data"`
+}
+
+func TestMarshalChecksum(t *testing.T) {
+	chunk := checksumChunk{Type: [4]byte{'I', 'E', 'N', 'D'}, Data: []byte{1, 2}}
+	b, err := Marshal(&chunk)
+	assert.NoError(t, err)
+	crc := crc32.ChecksumIEEE([]byte{'I', 'E', 'N', 'D', 1, 2})
+	assert.Equal(t, []byte{
+		0, 0, 0, 2, 'I', 'E', 'N', 'D', 1, 2,
+		byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc),
+	}, b)
+	// the marshalled value isn't modified
+	assert.Equal(t, uint32(0), chunk.CRC)
+
+	var decoded checksumChunk
+	assert.NoError(t, Unmarshal(b, &decoded))
+	assert.Equal(t, crc, decoded.CRC)
+
+	decoded = checksumChunk{}
+	assert.NoError(t, NewDecoder(bytes.NewReader(b)).Decode(&decoded))
+	assert.Equal(t, crc, decoded.CRC)
+}
+
+func TestChecksumBeforeRange(t *testing.T) {
+	header := struct {
+		Sum   uint8 `binstruct:"checksum=sum8,over=A..B"`
+		A     uint16
+		B     uint8
+		Inner struct {
+			Xor uint8 `binstruct:"checksum=xor8,over=C"`
+			C   [2]byte
+		}
+	}{A: 0x0102, B: 0xFF}
+	header.Inner.C = [2]byte{0x0F, 0xF0}
+	b, err := Marshal(&header)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x02, 0x02, 0x01, 0xFF, 0xFF, 0x0F, 0xF0}, b)
+
+	assert.NoError(t, NewDecoder(bytes.NewReader(b)).Decode(&header))
+	assert.Equal(t, uint8(0x02), header.Sum)
+}
+
+func TestChecksumCoveringChecksum(t *testing.T) {
+	// the outer checksum covers the inner checksum once it's computed
+	value := struct {
+		Outer uint8 `binstruct:"checksum=sum8,over=Inner..A"`
+		Inner uint8 `binstruct:"checksum=sum8,over=A"`
+		A     uint8
+	}{A: 3}
+	b, err := Marshal(&value)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{6, 3, 3}, b)
+
+	cyclic := struct {
+		A uint8 `binstruct:"checksum=sum8,over=B"`
+		B uint8 `binstruct:"checksum=sum8,over=A"`
+	}{}
+	_, err = Marshal(&cyclic)
+	assert.Equal(t, ErrOptionOverInvalid, errors.Cause(err))
+}
+
+func TestUnmarshalChecksumMismatch(t *testing.T) {
+	data := []byte{0, 0, 0, 1, 'I', 'E', 'N', 'D', 1, 0xDE, 0xAD, 0xBE, 0xEF}
+	var chunk checksumChunk
+	err := Unmarshal(data, &chunk)
+	if e, ok := errors.Cause(err).(*ChecksumError); assert.True(t, ok) {
+		assert.Equal(t, ChecksumCRC32, e.Algorithm)
+		assert.Equal(t, uint64(0xDEADBEEF), e.Expected)
+		assert.Equal(t, uint64(crc32.ChecksumIEEE(data[4:9])), e.Actual)
+	}
+	if e, ok := err.(*FieldError); assert.True(t, ok) {
+		assert.Equal(t, "CRC", e.Path)
+	}
+}
+
+func TestChecksumAlgorithms(t *testing.T) {
+	check := []byte("123456789")
+	for name, expected := range map[string]uint64{
+		ChecksumCRC32:      0xCBF43926,
+		ChecksumCRC32C:     0xE3069283,
+		ChecksumAdler32:    0x091E01DE,
+		ChecksumCRC16CCITT: 0x29B1,
+		ChecksumXOR8:       0x31,
+		ChecksumSum8:       0xDD,
+		ChecksumSum16:      0x01DD,
+		ChecksumSum32:      0x01DD,
+	} {
+		fn, ok := lookupChecksum(name)
+		if assert.True(t, ok, name) {
+			assert.Equal(t, expected, fn(check), name)
+		}
+	}
+}
+
+func TestRegisterChecksum(t *testing.T) {
+	RegisterChecksum("test-length", func(b []byte) uint64 {
+		return uint64(len(b))
+	})
+	value := struct {
+		Data [3]byte
+		Len  uint16 `binstruct:"checksum=test-length,over=Data"`
+	}{}
+	b, err := Marshal(&value)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 3, 0}, b)
+
+	assert.Panics(t, func() {
+		RegisterChecksum("test-length", func(b []byte) uint64 { return 0 })
+	})
+	assert.Panics(t, func() {
+		RegisterChecksum("", func(b []byte) uint64 { return 0 })
+	})
+}
+
+func TestChecksumInvalid(t *testing.T) {
+	unknown := struct {
+		A   uint8
+		Sum uint8 `binstruct:"checksum=md4,over=A"`
+	}{}
+	_, err := Marshal(&unknown)
+	assert.Equal(t, ErrOptionChecksumInvalid, errors.Cause(err))
+
+	notInteger := struct {
+		A   uint8
+		Sum [4]byte `binstruct:"checksum=crc32,over=A"`
+	}{}
+	_, err = Marshal(&notInteger)
+	assert.Equal(t, ErrOptionChecksumInvalid, errors.Cause(err))
+
+	missingOver := struct {
+		Sum uint8 `binstruct:"checksum=sum8"`
+	}{}
+	_, err = Marshal(&missingOver)
+	assert.Equal(t, ErrOptionOverInvalid, errors.Cause(err))
+
+	overOnly := struct {
+		A uint8
+		B uint8 `binstruct:"over=A"`
+	}{}
+	_, err = Marshal(&overOnly)
+	assert.Equal(t, ErrOptionOverInvalid, errors.Cause(err))
+
+	unknownField := struct {
+		Sum uint8 `binstruct:"checksum=sum8,over=Missing"`
+	}{}
+	_, err = Marshal(&unknownField)
+	assert.Equal(t, ErrOptionOverInvalid, errors.Cause(err))
+
+	self := struct {
+		A   uint8
+		Sum uint8 `binstruct:"checksum=sum8,over=A..Sum"`
+	}{}
+	_, err = Marshal(&self)
+	assert.Equal(t, ErrOptionOverInvalid, errors.Cause(err))
+}
@@ -0,0 +1,81 @@
+package binstruct
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrOptionIfInvalid      = errors.New("tag option if must compare a sibling field with an integer")
+	ErrOptionIfFieldInvalid = errors.New("tag option if must reference a boolean or integer field")
+	ErrOptionIfBitfield     = errors.New("tag option if cannot be used with bitfields")
+)
+
+// conditionOperators are the operators supported by conditions, two
+// character operators are listed first so they're matched before the
+// single character operators they begin with.
+var conditionOperators = []string{">=", "<=", "==", "!=", "&", ">", "<"}
+
+// condition determines whether a field exists based on the value of
+// a sibling field, such as Flags&0x4 or Version>=3.
+type condition struct {
+	Field    string
+	Operator string
+	Value    int64
+}
+
+// parseCondition parses a condition expression, an expression
+// consisting of only a field name is true when the field is non-zero.
+func parseCondition(expression string) (*condition, error) {
+	for _, operator := range conditionOperators {
+		if index := strings.Index(expression, operator); index >= 0 {
+			value, err := strconv.ParseInt(strings.TrimSpace(expression[index+len(operator):]), 0, 64)
+			if err != nil {
+				return nil, ErrOptionIfInvalid
+			}
+			field := strings.TrimSpace(expression[:index])
+			if field == "" {
+				return nil, ErrOptionIfInvalid
+			}
+			return &condition{Field: field, Operator: operator, Value: value}, nil
+		}
+	}
+	field := strings.TrimSpace(expression)
+	if field == "" {
+		return nil, ErrOptionIfInvalid
+	}
+	return &condition{Field: field, Operator: "!=", Value: 0}, nil
+}
+
+// Evaluate determines whether the condition is met by the sibling
+// field of the parent struct.
+func (c *condition) Evaluate(parent reflect.Value) bool {
+	var value int64
+	if field := dereference(parent.FieldByName(c.Field)); field.Kind() == reflect.Bool {
+		if field.Bool() {
+			value = 1
+		}
+	} else {
+		value = intValue(field)
+	}
+	switch c.Operator {
+	case ">=":
+		return value >= c.Value
+	case "<=":
+		return value <= c.Value
+	case "==":
+		return value == c.Value
+	case "!=":
+		return value != c.Value
+	case "&":
+		return value&c.Value != 0
+	case ">":
+		return value > c.Value
+	case "<":
+		return value < c.Value
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package binstruct
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCondition(t *testing.T) {
+	c, err := parseCondition("Flags&0x4")
+	assert.NoError(t, err)
+	assert.Equal(t, &condition{"Flags", "&", 4}, c)
+
+	c, err = parseCondition("Version >= 3")
+	assert.NoError(t, err)
+	assert.Equal(t, &condition{"Version", ">=", 3}, c)
+
+	c, err = parseCondition("Kind==-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &condition{"Kind", "==", -1}, c)
+
+	c, err = parseCondition("HasName")
+	assert.NoError(t, err)
+	assert.Equal(t, &condition{"HasName", "!=", 0}, c)
+
+	_, err = parseCondition("Version>=x")
+	assert.Equal(t, ErrOptionIfInvalid, err)
+	_, err = parseCondition(">=3")
+	assert.Equal(t, ErrOptionIfInvalid, err)
+	_, err = parseCondition("")
+	assert.Equal(t, ErrOptionIfInvalid, err)
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	foo := struct {
+		A int8
+		B *uint16
+		C bool
+	}{A: -2, C: true}
+	b := uint16(6)
+	foo.B = &b
+	v := reflect.ValueOf(foo)
+
+	assert.True(t, (&condition{"A", "<", 0}).Evaluate(v))
+	assert.True(t, (&condition{"A", "<=", -2}).Evaluate(v))
+	assert.False(t, (&condition{"A", ">", -2}).Evaluate(v))
+	assert.True(t, (&condition{"B", "&", 4}).Evaluate(v))
+	assert.False(t, (&condition{"B", "&", 1}).Evaluate(v))
+	assert.True(t, (&condition{"B", "==", 6}).Evaluate(v))
+	assert.True(t, (&condition{"B", ">=", 6}).Evaluate(v))
+	assert.True(t, (&condition{"C", "!=", 0}).Evaluate(v))
+}
+
+func TestParseStructCondition(t *testing.T) {
+	missing := struct {
+		A uint8 `binstruct:"if=B&1"`
+		B uint8
+	}{}
+	_, err := parseStruct(missing)
+	assert.EqualError(t, err, "cannot use field B for if")
+
+	invalid := struct {
+		A string
+		B uint8 `binstruct:"if=A"`
+	}{}
+	_, err = parseStruct(invalid)
+	assert.EqualError(t, err, "cannot use field A for if")
+
+	syntax := struct {
+		A uint8
+		B uint8 `binstruct:"if=A>=B"`
+	}{}
+	_, err = parseStruct(syntax)
+	assert.Equal(t, ErrOptionIfInvalid, err)
+
+	bitfield := struct {
+		A uint8
+		B uint8 `binstruct:"bits=4,if=A"`
+	}{}
+	_, err = parseStruct(bitfield)
+	assert.Equal(t, ErrOptionIfBitfield, err)
+}
+
+type conditionalRecord struct {
+	Version uint8
+	Flags   uint8
+	Size    uint32 `binstruct:"if=Version>=3"`
+	Name    string `binstruct:"if=Flags&0x4,stringtype=null"`
+	Tail    uint8
+}
+
+func TestUnmarshalCondition(t *testing.T) {
+	record := conditionalRecord{Size: 7, Name: "stale"}
+	assert.NoError(t, Unmarshal([]byte{2, 0, 9}, &record))
+	assert.Equal(t, conditionalRecord{Version: 2, Tail: 9}, record)
+
+	assert.NoError(t, Unmarshal([]byte{3, 4, 1, 0, 0, 0, 'a', 0, 9}, &record))
+	assert.Equal(t, conditionalRecord{3, 4, 1, "a", 9}, record)
+}
+
+func TestMarshalCondition(t *testing.T) {
+	data, err := Marshal(conditionalRecord{Version: 2, Size: 1, Name: "a", Tail: 9})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, 0, 9}, data)
+
+	data, err = Marshal(conditionalRecord{3, 4, 1, "a", 9})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3, 4, 1, 0, 0, 0, 'a', 0, 9}, data)
+}
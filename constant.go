@@ -0,0 +1,98 @@
+package binstruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var ErrOptionConstInvalid = errors.New("tag option const must be an integer for integer fields, or text or hex bytes fitting byte arrays and fixed-length strings")
+
+// ConstError is returned when the bytes read for a constant field, such
+// as a magic number, don't match the constant.
+type ConstError struct {
+	// Expected is the encoding of the constant.
+	Expected []byte
+	// Actual is the bytes read.
+	Actual []byte
+}
+
+func (e *ConstError) Error() string {
+	return fmt.Sprintf("expected constant % X but read % X", e.Expected, e.Actual)
+}
+
+// parseConst parses the const option as a value of the field's type.
+// Byte arrays must be filled by the constant, whereas fixed-length
+// strings are padded as usual.
+func parseConst(f *fieldDefinition) (reflect.Value, error) {
+	literal := f.Options.Const
+	v := reflect.New(f.Type).Elem()
+	switch kind := f.Type.Kind(); {
+	case isInteger(kind) && f.Options.Bits == 0:
+		bitSize := kindSize(kind) * 8
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value, err := strconv.ParseInt(literal, 0, bitSize)
+			if err != nil {
+				return v, ErrOptionConstInvalid
+			}
+			v.SetInt(value)
+		default:
+			value, err := strconv.ParseUint(literal, 0, bitSize)
+			if err != nil {
+				return v, ErrOptionConstInvalid
+			}
+			v.SetUint(value)
+		}
+	case kind == reflect.Array && f.Type.Elem().Kind() == reflect.Uint8:
+		b := parseBytesLiteral(literal)
+		if len(b) != v.Len() {
+			return v, ErrOptionConstInvalid
+		}
+		reflect.Copy(v, reflect.ValueOf(b))
+	case kind == reflect.String && f.Options.StringType == StringFixed &&
+		f.Options.Len > 0 && f.Options.LenField == "":
+		s := string(parseBytesLiteral(literal))
+		b, err := f.Encoding.Encode(s)
+		if err != nil || int64(len(b)) > f.stringSize(f.Options.Len) {
+			return v, ErrOptionConstInvalid
+		}
+		v.SetString(s)
+	default:
+		return v, ErrOptionConstInvalid
+	}
+	return v, nil
+}
+
+// constBytes encodes the field's constant using the byte order.
+func constBytes(f *fieldDefinition, order binary.ByteOrder) ([]byte, error) {
+	dst := &bufferSink{}
+	e := newEncoder(dst)
+	e.order = order
+	if err := e.encodeValue(f, f.Const); err != nil {
+		return nil, err
+	}
+	return dst.buf, nil
+}
+
+// decodeConst reads the bytes of the field's constant, failing unless
+// they match the encoded constant.
+func (d *decoder) decodeConst(f *fieldDefinition, v reflect.Value) error {
+	expected, err := constBytes(f, d.order)
+	if err != nil {
+		return err
+	}
+	b, err := d.read(int64(len(expected)))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(b, expected) {
+		return &ConstError{Expected: expected, Actual: b}
+	}
+	v.Set(f.Const)
+	return nil
+}
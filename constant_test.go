@@ -0,0 +1,97 @@
+package binstruct
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type constHeader struct {
+	Signature [8]byte `binstruct:"magic=0x89504E470D0A1A0A"`
+	Class     uint32  `binstruct:"endian=big,const=0xCAFEBABE"`
+	Kind      string  `binstruct:"len=4,const=RIFF"`
+	Version   int8    `binstruct:"const=-1"`
+	Value     uint8
+}
+
+var constHeaderBytes = []byte{
+	0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A,
+	0xCA, 0xFE, 0xBA, 0xBE,
+	'R', 'I', 'F', 'F',
+	0xFF,
+	7,
+}
+
+func TestMarshalConst(t *testing.T) {
+	// the constants are written regardless of the field values
+	b, err := Marshal(&constHeader{Class: 1, Value: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, constHeaderBytes, b)
+}
+
+func TestUnmarshalConst(t *testing.T) {
+	var header constHeader
+	assert.NoError(t, Unmarshal(constHeaderBytes, &header))
+	assert.Equal(t, [8]byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}, header.Signature)
+	assert.Equal(t, uint32(0xCAFEBABE), header.Class)
+	assert.Equal(t, "RIFF", header.Kind)
+	assert.Equal(t, int8(-1), header.Version)
+	assert.Equal(t, uint8(7), header.Value)
+
+	header = constHeader{}
+	assert.NoError(t, NewDecoder(bytes.NewReader(constHeaderBytes)).Decode(&header))
+	assert.Equal(t, uint32(0xCAFEBABE), header.Class)
+}
+
+func TestUnmarshalConstMismatch(t *testing.T) {
+	data := append([]byte(nil), constHeaderBytes...)
+	data[9] = 0
+	var header constHeader
+	err := Unmarshal(data, &header)
+	if e, ok := errors.Cause(err).(*ConstError); assert.True(t, ok) {
+		assert.Equal(t, []byte{0xCA, 0xFE, 0xBA, 0xBE}, e.Expected)
+		assert.Equal(t, []byte{0xCA, 0x00, 0xBA, 0xBE}, e.Actual)
+	}
+	assert.EqualError(t, err, "failed to decode field Class at offset 12: expected constant CA FE BA BE but read CA 00 BA BE")
+
+	// text constants are compared after padding
+	short := struct {
+		Kind string `binstruct:"len=4,const=MZ"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{'M', 'Z', 0, 0}, &short))
+	assert.Equal(t, "MZ", short.Kind)
+	err = Unmarshal([]byte{'M', 'Z', 'X', 0}, &short)
+	assert.IsType(t, &ConstError{}, errors.Cause(err))
+}
+
+func TestConstInvalid(t *testing.T) {
+	for _, v := range []interface{}{
+		&struct {
+			A uint8 `binstruct:"const=256"`
+		}{},
+		&struct {
+			A uint16 `binstruct:"const=MZ"`
+		}{},
+		&struct {
+			A [4]byte `binstruct:"magic=0x0102"`
+		}{},
+		&struct {
+			A string `binstruct:"len=2,magic=RIFF"`
+		}{},
+		&struct {
+			A string `binstruct:"stringtype=null,magic=RIFF"`
+		}{},
+		&struct {
+			A []byte `binstruct:"len=2,magic=MZ"`
+		}{},
+		&struct {
+			A uint8 `binstruct:"bits=4,const=1"`
+			B uint8 `binstruct:"bits=4"`
+		}{},
+	} {
+		_, err := Marshal(v)
+		assert.Equal(t, ErrOptionConstInvalid, errors.Cause(err))
+	}
+}
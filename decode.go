@@ -1,10 +1,593 @@
 package binstruct
 
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
 // Unmarshaler provides an interface for types to unmarshal themselves to binary.
+// When a field's type implements Unmarshaler, the bytes given by the field's
+// Len or LenField options are passed to UnmarshalBinary.
 type Unmarshaler interface {
 	UnmarshalBinary([]byte) error
 }
 
+// ReaderUnmarshaler provides an interface for types to unmarshal themselves
+// from a stream, allowing the type to determine its own length.
+// UnmarshalBinaryFrom reads from the field's position and returns the number
+// of bytes belonging to the value, decoding continues from the end of those
+// bytes. ReaderUnmarshaler takes precedence over Unmarshaler.
+type ReaderUnmarshaler interface {
+	UnmarshalBinaryFrom(r io.Reader) (int64, error)
+}
+
+var (
+	unmarshalerType       = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	readerUnmarshalerType = reflect.TypeOf((*ReaderUnmarshaler)(nil)).Elem()
+)
+
+var (
+	ErrInvalidUnmarshalValue = errors.New("unmarshal value must be a non-nil pointer to a struct")
+	ErrUnsupportedKind       = errors.New("field kind is not supported")
+	ErrLenRequired           = errors.New("field requires either len or lenfield")
+	ErrNegativeLen           = errors.New("field length cannot be negative")
+	ErrSizeExceeded          = errors.New("value exceeds the size of its bounded region")
+	ErrNegativePosition      = errors.New("field position cannot be negative")
+)
+
+// Unmarshal parses the binary data and stores the result in the struct
+// pointed to by v.
 func Unmarshal(data []byte, v interface{}) error {
+	value, definition, err := unmarshalTarget(v)
+	if err != nil {
+		return err
+	}
+	d := newDecoder(byteSource(data))
+	return d.decode(definition, value)
+}
+
+// unmarshalTarget resolves the struct pointed to by v and its definition.
+func unmarshalTarget(v interface{}) (reflect.Value, *structDefinition, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return reflect.Value{}, nil, ErrInvalidUnmarshalValue
+	}
+	value = indirect(value)
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, nil, ErrInvalidUnmarshalValue
+	}
+	definition, err := cachedStructType(value.Type())
+	if err != nil {
+		return reflect.Value{}, nil, err
+	}
+	return value, definition, nil
+}
+
+// decoder reads values from the source as described by the struct
+// and field definitions.
+type decoder struct {
+	src   source
+	pos   int64
+	order binary.ByteOrder
+	// base is the position of the source within the input, used
+	// to report absolute offsets.
+	base int64
+	// bitfield is the storage unit shared by the current bitfields.
+	bitfield uint64
+	// end is the position following the bounded region being read,
+	// or -1 when reading isn't bounded.
+	end int64
+	// start is the position of the struct being read.
+	start int64
+	// pointers are the pointers whose pointees haven't been read.
+	pointers []*pointer
+}
+
+// newDecoder creates a decoder reading from the start of the source.
+func newDecoder(src source) *decoder {
+	return &decoder{
+		src:   src,
+		order: byteOrder(defaultFieldOptions.Endian),
+		end:   -1,
+	}
+}
+
+// read returns the next n bytes and advances the position.
+func (d *decoder) read(n int64) ([]byte, error) {
+	if n < 0 {
+		return nil, ErrNegativeLen
+	}
+	if d.end >= 0 && n > d.end-d.pos {
+		return nil, d.sizeError(n)
+	}
+	b, err := d.src.readAt(d.pos, n)
+	if err != nil {
+		if e, ok := err.(*FieldError); ok {
+			e.Offset += d.base
+		}
+		return nil, err
+	}
+	d.pos += n
+	return b, nil
+}
+
+// sizeError creates the error returned when n bytes at the position
+// exceed the bounded region.
+func (d *decoder) sizeError(n int64) error {
+	return &FieldError{
+		Offset:    d.base + d.pos,
+		Expected:  n,
+		Available: d.end - d.pos,
+		Err:       ErrSizeExceeded,
+	}
+}
+
+// atEnd determines whether no bytes remain to be read.
+func (d *decoder) atEnd() (bool, error) {
+	if d.end >= 0 {
+		return d.pos >= d.end, nil
+	}
+	return d.src.atEnd(d.pos)
+}
+
+// readUntilNull returns the bytes up to a null code unit of the size
+// and advances the position past the null, which is not included.
+func (d *decoder) readUntilNull(size int) ([]byte, error) {
+	var result []byte
+	for {
+		b, err := d.read(int64(size))
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Count(b, []byte{0}) == size {
+			return result, nil
+		}
+		result = append(result, b...)
+	}
+}
+
+// readRest returns the bytes remaining in the bounded region or the
+// source, and advances the position to the end.
+func (d *decoder) readRest() ([]byte, error) {
+	if d.end >= 0 {
+		return d.read(d.end - d.pos)
+	}
+	var result []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := d.src.readSome(d.pos, buf)
+		result = append(result, buf[:n]...)
+		d.pos += int64(n)
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readLen returns the bytes of a field with the length given by its
+// options, the remaining bytes are returned when Len is LenRest.
+func (d *decoder) readLen(f *fieldDefinition, parent reflect.Value) ([]byte, error) {
+	if f.Options.Len == LenRest {
+		return d.readRest()
+	}
+	n, err := fieldLen(f, parent)
+	if err != nil {
+		return nil, err
+	}
+	return d.read(n)
+}
+
+// readUint reads an unsigned integer of the given size in bytes.
+func (d *decoder) readUint(size int) (uint64, error) {
+	b, err := d.read(int64(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(d.order.Uint16(b)), nil
+	case 4:
+		return uint64(d.order.Uint32(b)), nil
+	case 8:
+		return d.order.Uint64(b), nil
+	}
+	return 0, ErrUnsupportedKind
+}
+
+// readInt reads a signed integer of the given size in bytes.
+func (d *decoder) readInt(size int) (int64, error) {
+	value, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+	// sign-extend the value from the given size
+	shift := uint(64 - size*8)
+	return int64(value<<shift) >> shift, nil
+}
+
+// readInteger reads an integer of the kind using the field's integer
+// type, returning the bits of the signed or unsigned value.
+func (d *decoder) readInteger(f *fieldDefinition, kind reflect.Kind) (uint64, error) {
+	if isVarint(f.Options.IntType) {
+		value, err := d.readVarint(f.Options.IntType)
+		if err != nil {
+			return 0, err
+		}
+		if !fitsKind(value, kind) {
+			return 0, ErrVarintOverflow
+		}
+		return value, nil
+	}
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := d.readInt(kindSize(kind))
+		return uint64(value), err
+	}
+	return d.readUint(kindSize(kind))
+}
+
+// readPrefix reads the length prefix of the string type.
+func (d *decoder) readPrefix(t StringType) (int64, error) {
+	if isVarint(t) {
+		value, err := d.readVarint(t)
+		return int64(value), err
+	}
+	return d.readInt(stringPrefixSize(t))
+}
+
+// decode decodes the struct followed by the pointees of its pointers.
+func (d *decoder) decode(s *structDefinition, v reflect.Value) error {
+	if err := d.decodeStruct(s, v); err != nil {
+		return err
+	}
+	return d.resolvePointers()
+}
+
+// decodeStruct decodes each of the struct's fields in the order
+// they're declared, the checksums are verified once all the fields
+// have been read.
+func (d *decoder) decodeStruct(s *structDefinition, v reflect.Value) error {
+	outer := d.start
+	d.start = d.pos
+	defer func() { d.start = outer }()
+
+	var extents map[string]fieldExtent
+	if len(s.Checksums) > 0 {
+		extents = make(map[string]fieldExtent, len(s.Fields))
+	}
+	for _, f := range s.Fields {
+		extent, err := d.decodeField(f, v)
+		if err != nil {
+			return d.fieldError(err, f.Field.Name)
+		}
+		if extents != nil {
+			extents[f.Field.Name] = extent
+		}
+	}
+	for _, f := range s.Checksums {
+		if f.Condition != nil && !f.Condition.Evaluate(v) {
+			continue
+		}
+		if err := d.verifyChecksum(f, v, extents); err != nil {
+			return d.fieldError(err, f.Field.Name)
+		}
+	}
+	return nil
+}
+
+// fieldError wraps the error with the path of the field or element
+// being decoded.
+func (d *decoder) fieldError(err error, name string) error {
+	return wrapFieldError(err, "decode", name, d.base+d.pos)
+}
+
+// decodeField positions the decoder as specified by the field
+// options and decodes the field's value. Fields which aren't read
+// have an empty extent at the current position.
+func (d *decoder) decodeField(f *fieldDefinition, parent reflect.Value) (fieldExtent, error) {
+	extent := fieldExtent{Start: d.pos, Value: d.pos, End: d.pos}
+	// fields which don't exist are left as their zero value
+	if f.Condition != nil && !f.Condition.Evaluate(parent) {
+		v := fieldValue(f, parent)
+		v.Set(reflect.Zero(v.Type()))
+		return extent, nil
+	}
+	// bitfields following the first in their unit have already been read
+	if f.Bitfield != nil && !f.Bitfield.First(f) {
+		d.unpackBitfield(f, parent)
+		return extent, nil
+	}
+	options := f.Options
+	if options.OffsetField != "" {
+		d.pos = intValue(parent.FieldByName(options.OffsetField))
+	} else if options.Offset != 0 {
+		d.pos = options.Offset
+	}
+	extent.Start = d.pos
+	d.pos += options.Skip
+	if options.Align {
+		d.pos = align(d.pos, options.AlignBytes)
+	}
+	if d.pos < 0 {
+		return extent, ErrNegativePosition
+	}
+	order, err := f.byteOrder(parent, d.order)
+	if err != nil {
+		return extent, err
+	}
+	// the byte order is inherited by nested structs
+	inherited := d.order
+	d.order = order
+	defer func() { d.order = inherited }()
+
+	extent.Value = d.pos
+	if f.Bitfield != nil {
+		if d.bitfield, err = d.readUint(f.Bitfield.Unit.Size); err == nil {
+			d.unpackBitfield(f, parent)
+		}
+	} else if options.Ptr != "" {
+		err = d.decodePointers(f, parent, fieldValue(f, parent))
+	} else if v := indirect(fieldValue(f, parent)); f.Const.IsValid() {
+		err = d.decodeConst(f, v)
+	} else if f.Type == lazyType {
+		err = d.decodeLazy(f, parent, v)
+	} else if options.SizeField != "" {
+		err = d.decodeBounded(f, parent, v)
+	} else {
+		err = d.decodeValue(f, parent, v)
+	}
+	extent.End = d.pos
+	return extent, err
+}
+
+// decodeBounded decodes the value within the number of bytes given
+// by the field's SizeField, any bytes remaining once the value has
+// been decoded are skipped.
+func (d *decoder) decodeBounded(f *fieldDefinition, parent reflect.Value, v reflect.Value) error {
+	n := intValue(parent.FieldByName(f.Options.SizeField))
+	if n < 0 {
+		return ErrNegativeLen
+	}
+	if d.end >= 0 && n > d.end-d.pos {
+		return d.sizeError(n)
+	}
+	end := d.pos + n
+	outer := d.end
+	d.end = end
+	err := d.decodeValue(f, parent, v)
+	d.end = outer
+	if err != nil {
+		return err
+	}
+	d.pos = end
 	return nil
 }
+
+// unpackBitfield sets the field from its bits within the storage
+// unit most recently read.
+func (d *decoder) unpackBitfield(f *fieldDefinition, parent reflect.Value) {
+	if f.Field.PkgPath == "" {
+		f.Bitfield.unpack(d.bitfield, indirect(parent.FieldByIndex(f.Field.Index)))
+	}
+}
+
+// decodeValue decodes the value of the field, parent is the struct
+// the field belongs to.
+func (d *decoder) decodeValue(f *fieldDefinition, parent reflect.Value, v reflect.Value) error {
+	if u, ok := v.Addr().Interface().(ReaderUnmarshaler); ok {
+		return d.decodeFrom(u)
+	}
+	if u, ok := v.Addr().Interface().(Unmarshaler); ok {
+		b, err := d.readLen(f, parent)
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalBinary(b)
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if f.Options.Switch == "" {
+			return ErrUnsupportedKind
+		}
+		return d.decodeVariant(f, parent, v)
+	case reflect.String:
+		return d.decodeString(f, parent, v)
+	case reflect.Slice:
+		bytes := v.Type().Elem().Kind() == reflect.Uint8 && f.Options.Mask == 0 && !isVarint(f.Options.IntType) &&
+			(f.Enum == nil || f.Options.Enum != EnumStrict)
+		if f.Options.Len == LenRest {
+			if bytes {
+				b, err := d.readRest()
+				if err != nil {
+					return err
+				}
+				v.SetBytes(b)
+				return nil
+			}
+			// elements are read until no bytes remain
+			return d.decodeSliceUntil(f, v)
+		}
+		if f.Sentinel != nil {
+			return d.decodeSliceUntil(f, v)
+		}
+		n, err := d.sliceLen(f, parent)
+		if err != nil {
+			return err
+		}
+		if bytes {
+			b, err := d.read(n)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		if f.Options.LenUnit == LenUnitBytes {
+			return d.decodeSliceBytes(f, v, n)
+		}
+		slice := d.makeSlice(v.Type(), n)
+		for i := 0; int64(i) < n; i++ {
+			slice = d.appendElement(slice)
+			if err := d.decodeElement(f, slice.Index(i)); err != nil {
+				return d.fieldError(err, indexName(i))
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return d.decodeElement(f, v)
+}
+
+// decodeElement decodes values which don't depend on sibling
+// fields, such as numbers, nested structs and the elements of
+// slices and arrays.
+func (d *decoder) decodeElement(f *fieldDefinition, v reflect.Value) error {
+	v = indirect(v)
+	if u, ok := v.Addr().Interface().(ReaderUnmarshaler); ok {
+		return d.decodeFrom(u)
+	}
+	if _, ok := v.Addr().Interface().(Unmarshaler); ok {
+		// the length of each element is unknown
+		return ErrLenRequired
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		value, err := d.readUint(1)
+		if err != nil {
+			return err
+		}
+		v.SetBool(value != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := d.readInteger(f, v.Kind())
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(value ^ f.Options.Mask))
+		return f.checkEnum(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := d.readInteger(f, v.Kind())
+		if err != nil {
+			return err
+		}
+		v.SetUint(value ^ f.Options.Mask)
+		return f.checkEnum(v)
+	case reflect.Float32, reflect.Float64:
+		value, err := d.readFloat(f, v.Kind())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(value)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decodeElement(f, v.Index(i)); err != nil {
+				return d.fieldError(err, indexName(i))
+			}
+		}
+	case reflect.Struct:
+		if f.Children == nil {
+			return ErrUnsupportedKind
+		}
+		return d.decodeStruct(f.Children, v)
+	default:
+		return ErrUnsupportedKind
+	}
+	return nil
+}
+
+// decodeFrom delegates decoding to the value, which reads from the
+// current position.
+func (d *decoder) decodeFrom(u ReaderUnmarshaler) error {
+	var r io.Reader = &sourceReader{src: d.src, pos: d.pos}
+	if d.end >= 0 {
+		r = io.LimitReader(r, d.end-d.pos)
+	}
+	n, err := u.UnmarshalBinaryFrom(r)
+	if err == io.EOF {
+		// the value is incomplete if the bytes ran out
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return ErrNegativeLen
+	}
+	d.pos += n
+	return nil
+}
+
+// decodeString decodes a string value using the field's string type.
+func (d *decoder) decodeString(f *fieldDefinition, parent reflect.Value, v reflect.Value) error {
+	var b []byte
+	var err error
+	switch f.Options.StringType {
+	case StringFixed:
+		if f.Options.Len == LenRest {
+			b, err = d.readRest()
+		} else {
+			var n int64
+			if n, err = fieldLen(f, parent); err == nil {
+				b, err = d.read(f.stringSize(n))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// remove the padding from the remainder of the string
+		b = trimPadding(b, f.Options.StringPad, f.Encoding.UnitSize())
+	case StringNullTerminated:
+		if b, err = d.readUntilNull(f.Encoding.UnitSize()); err != nil {
+			return err
+		}
+	default:
+		n, err := d.readPrefix(f.Options.StringType)
+		if err != nil {
+			return err
+		}
+		if b, err = d.read(f.stringSize(n)); err != nil {
+			return err
+		}
+	}
+	s, err := f.Encoding.Decode(b)
+	if err != nil {
+		return err
+	}
+	v.SetString(s)
+	return nil
+}
+
+// fieldLen returns the length of the slice or string field, determined
+// by either the sibling field specified by LenField or by Len.
+func fieldLen(f *fieldDefinition, parent reflect.Value) (int64, error) {
+	var n int64
+	if f.Options.LenField != "" {
+		n = intValue(parent.FieldByName(f.Options.LenField))
+	} else if f.Options.Len != 0 {
+		n = f.Options.Len
+	} else {
+		return 0, ErrLenRequired
+	}
+	if n < 0 {
+		return 0, ErrNegativeLen
+	}
+	return n, nil
+}
+
+// align rounds the position up to the nearest multiple of n.
+func align(pos int64, n int64) int64 {
+	if n <= 0 {
+		return pos
+	}
+	if remainder := pos % n; remainder != 0 {
+		pos += n - remainder
+	}
+	return pos
+}
@@ -0,0 +1,406 @@
+package binstruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalNumbers(t *testing.T) {
+	foo := struct {
+		A int8
+		B uint16
+		C int32
+		D uint64
+		E bool
+		F float32
+		G float64
+		H *int16
+	}{}
+	data := []byte{
+		0xFF,
+		0x01, 0x02,
+		0xFE, 0xFF, 0xFF, 0xFF,
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01,
+		0x00, 0x00, 0xC0, 0x3F,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x40,
+		0x03, 0x00,
+	}
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, int8(-1), foo.A)
+	assert.Equal(t, uint16(0x0201), foo.B)
+	assert.Equal(t, int32(-2), foo.C)
+	assert.Equal(t, uint64(1), foo.D)
+	assert.Equal(t, true, foo.E)
+	assert.Equal(t, float32(1.5), foo.F)
+	assert.Equal(t, float64(2.5), foo.G)
+	if assert.NotNil(t, foo.H) {
+		assert.Equal(t, int16(3), *foo.H)
+	}
+}
+
+func TestUnmarshalStrings(t *testing.T) {
+	foo := struct {
+		A string `binstruct:"len=4"`
+		B string `binstruct:"len=4,stringpad=x"`
+		C string `binstruct:"stringtype=null"`
+		D string `binstruct:"stringtype=int16"`
+		E uint8
+		F string `binstruct:"lenfield=E"`
+	}{}
+	data := []byte("ab\x00\x00cdxxef\x00\x02\x00gh\x03ijk")
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, "ab", foo.A)
+	assert.Equal(t, "cd", foo.B)
+	assert.Equal(t, "ef", foo.C)
+	assert.Equal(t, "gh", foo.D)
+	assert.Equal(t, uint8(3), foo.E)
+	assert.Equal(t, "ijk", foo.F)
+}
+
+func TestUnmarshalSlicesAndArrays(t *testing.T) {
+	type bar struct {
+		X uint8
+		Y uint8
+	}
+	foo := struct {
+		A []byte `binstruct:"len=2"`
+		B uint8
+		C []uint16 `binstruct:"lenfield=B"`
+		D [2]bar
+		E []bar `binstruct:"len=1"`
+		F bar
+	}{}
+	data := []byte{1, 2, 2, 3, 0, 4, 0, 5, 6, 7, 8, 9, 10, 11, 12}
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, []byte{1, 2}, foo.A)
+	assert.Equal(t, []uint16{3, 4}, foo.C)
+	assert.Equal(t, [2]bar{{5, 6}, {7, 8}}, foo.D)
+	assert.Equal(t, []bar{{9, 10}}, foo.E)
+	assert.Equal(t, bar{11, 12}, foo.F)
+}
+
+func TestUnmarshalPositioning(t *testing.T) {
+	foo := struct {
+		A uint8
+		B uint8 `binstruct:"skip=1"`
+		C uint8 `binstruct:"align,alignbytes=4"`
+		D uint8 `binstruct:"offset=6"`
+		E uint8 `binstruct:"offsetfield=A"`
+		F uint8
+	}{}
+	data := []byte{1, 0, 2, 0, 3, 0, 4, 5}
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, uint8(1), foo.A)
+	assert.Equal(t, uint8(2), foo.B)
+	assert.Equal(t, uint8(3), foo.C)
+	assert.Equal(t, uint8(4), foo.D)
+	assert.Equal(t, uint8(0), foo.E)
+	assert.Equal(t, uint8(2), foo.F)
+}
+
+func TestUnmarshalBlankFields(t *testing.T) {
+	foo := struct {
+		A uint8
+		_ [2]byte
+		B uint8
+		_ uint16 `binstruct:"skip=1"`
+		C uint8
+		d uint8
+	}{}
+	assert.NoError(t, Unmarshal([]byte{1, 0xAA, 0xAA, 2, 0, 0xBB, 0xBB, 3, 0xCC}, &foo))
+	assert.Equal(t, uint8(1), foo.A)
+	assert.Equal(t, uint8(2), foo.B)
+	assert.Equal(t, uint8(3), foo.C)
+	assert.Equal(t, uint8(0), foo.d)
+
+	// the bytes of blank fields are skipped in streams
+	foo.B = 0
+	assert.NoError(t, NewDecoder(bytes.NewReader([]byte{1, 0xAA, 0xAA, 2, 0, 0xBB, 0xBB, 3, 0xCC})).Decode(&foo))
+	assert.Equal(t, uint8(2), foo.B)
+
+	// unexported fields are skipped like blank fields
+	bar := struct {
+		A        uint8
+		reserved uint16
+		B        uint8
+	}{}
+	assert.NoError(t, Unmarshal([]byte{1, 0xAA, 0xAA, 2}, &bar))
+	assert.Equal(t, uint8(1), bar.A)
+	assert.Equal(t, uint16(0), bar.reserved)
+	assert.Equal(t, uint8(2), bar.B)
+}
+
+func TestUnmarshalMask(t *testing.T) {
+	foo := struct {
+		A uint16 `binstruct:"mask=0x8000"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{0x01, 0x80}, &foo))
+	assert.Equal(t, uint16(1), foo.A)
+}
+
+func TestUnmarshalInvalidValue(t *testing.T) {
+	foo := struct{}{}
+	assert.Equal(t, ErrInvalidUnmarshalValue, Unmarshal(nil, foo))
+	assert.Equal(t, ErrInvalidUnmarshalValue, Unmarshal(nil, nil))
+	var bar *struct{}
+	assert.Equal(t, ErrInvalidUnmarshalValue, Unmarshal(nil, bar))
+	baz := 1
+	assert.Equal(t, ErrInvalidUnmarshalValue, Unmarshal(nil, &baz))
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	short := struct {
+		A uint32
+	}{}
+	err := Unmarshal([]byte{1, 2}, &short)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+
+	missingLen := struct {
+		A string
+	}{}
+	err = Unmarshal([]byte{1, 2}, &missingLen)
+	assert.Equal(t, ErrLenRequired, errors.Cause(err))
+
+	unterminated := struct {
+		A string `binstruct:"stringtype=null"`
+	}{}
+	err = Unmarshal([]byte{'a', 'b'}, &unterminated)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+
+	unsupported := struct {
+		A map[string]int
+	}{}
+	err = Unmarshal([]byte{1, 2}, &unsupported)
+	assert.Equal(t, ErrUnsupportedKind, errors.Cause(err))
+}
+
+func TestUnmarshalEndian(t *testing.T) {
+	type bar struct {
+		X uint16
+		Y uint16 `binstruct:"endian=little"`
+	}
+	foo := struct {
+		A uint16
+		B uint16 `binstruct:"endian=big"`
+		C bar    `binstruct:"endian=big"`
+		D bar
+	}{}
+	data := []byte{1, 0, 0, 2, 0, 3, 4, 0, 5, 0, 6, 0}
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, uint16(1), foo.A)
+	assert.Equal(t, uint16(2), foo.B)
+	assert.Equal(t, bar{3, 4}, foo.C)
+	assert.Equal(t, bar{5, 6}, foo.D)
+}
+
+func TestUnmarshalCorruptLen(t *testing.T) {
+	// lengths near the maximum don't overflow the bounds checks
+	huge := struct {
+		N uint64
+		B []byte `binstruct:"lenfield=N"`
+	}{}
+	data := []byte{0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0}
+	err := Unmarshal(data, &huge)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+
+	bounded := struct {
+		Size uint8
+		A    struct {
+			N uint64
+			B []byte `binstruct:"lenfield=N"`
+		} `binstruct:"sizefield=Size"`
+	}{}
+	err = Unmarshal(append([]byte{9}, data...), &bounded)
+	assert.Equal(t, ErrSizeExceeded, errors.Cause(err))
+
+	// the elements aren't allocated before they're read
+	elements := struct {
+		N uint32
+		B []uint32 `binstruct:"lenfield=N"`
+	}{}
+	err = Unmarshal([]byte{0xFF, 0xFF, 0xFF, 0x7F}, &elements)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+	pointers := struct {
+		N uint32
+		B []*uint32 `binstruct:"lenfield=N,ptr=uint8"`
+	}{}
+	err = Unmarshal([]byte{0xFF, 0xFF, 0xFF, 0x7F}, &pointers)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+}
+
+func TestUnmarshalDefaultEndian(t *testing.T) {
+	defer SetDefaultOptions(defaultFieldOptions)
+	options := &FieldOptions{}
+	*options = *defaultFieldOptions
+	options.Endian = EndianBig
+	SetDefaultOptions(options)
+
+	foo := struct {
+		A uint16
+		B struct {
+			X uint16
+		}
+		C uint16 `binstruct:"endian=little"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{0, 1, 0, 2, 3, 0}, &foo))
+	assert.Equal(t, uint16(1), foo.A)
+	assert.Equal(t, uint16(2), foo.B.X)
+	assert.Equal(t, uint16(3), foo.C)
+}
+
+func TestUnmarshalEndianField(t *testing.T) {
+	type bar struct {
+		X uint16
+		Y uint32
+	}
+	foo := struct {
+		Big  bool
+		A    bar    `binstruct:"endianfield=Big"`
+		Mark uint16 `binstruct:"endian=big"`
+		B    bar    `binstruct:"endianfield=Mark"`
+	}{}
+	data := []byte{
+		1, 0, 1, 0, 0, 0, 2,
+		0xFF, 0xFE, 3, 0, 4, 0, 0, 0,
+	}
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, bar{1, 2}, foo.A)
+	assert.Equal(t, uint16(0xFFFE), foo.Mark)
+	assert.Equal(t, bar{3, 4}, foo.B)
+
+	data[7], data[8] = 0xFE, 0xFF
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, bar{0x0300, 0x04000000}, foo.B)
+
+	data[7] = 0
+	err := Unmarshal(data, &foo)
+	assert.Equal(t, ErrInvalidByteOrderMark, errors.Cause(err))
+}
+
+// reversedBytes is stored with its bytes in reverse order.
+type reversedBytes []byte
+
+func (r *reversedBytes) UnmarshalBinary(data []byte) error {
+	*r = make(reversedBytes, len(data))
+	for i, b := range data {
+		(*r)[len(data)-1-i] = b
+	}
+	return nil
+}
+
+func (r reversedBytes) MarshalBinary() ([]byte, error) {
+	data := make([]byte, len(r))
+	for i, b := range r {
+		data[len(r)-1-i] = b
+	}
+	return data, nil
+}
+
+// uvarint is stored as a variable-length integer.
+type uvarint uint64
+
+func (u *uvarint) UnmarshalBinaryFrom(r io.Reader) (int64, error) {
+	var value uint64
+	b := make([]byte, 1)
+	for n := int64(1); ; n++ {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return n, err
+		}
+		value |= uint64(b[0]&0x7F) << uint(7*(n-1))
+		if b[0] < 0x80 {
+			*u = uvarint(value)
+			return n, nil
+		}
+	}
+}
+
+func (u uvarint) MarshalBinary() ([]byte, error) {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, uint64(u))], nil
+}
+
+func TestUnmarshalUnmarshaler(t *testing.T) {
+	foo := struct {
+		N uint8
+		A reversedBytes `binstruct:"lenfield=N"`
+		B reversedBytes `binstruct:"len=2"`
+		C uvarint
+		D uint8
+		E [2]uvarint
+		F *uvarint
+	}{}
+	data := []byte{3, 1, 2, 3, 4, 5, 0xAC, 0x02, 6, 0x01, 0x80, 0x01, 0x7F}
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, reversedBytes{3, 2, 1}, foo.A)
+	assert.Equal(t, reversedBytes{5, 4}, foo.B)
+	assert.Equal(t, uvarint(300), foo.C)
+	assert.Equal(t, uint8(6), foo.D)
+	assert.Equal(t, [2]uvarint{1, 128}, foo.E)
+	if assert.NotNil(t, foo.F) {
+		assert.Equal(t, uvarint(127), *foo.F)
+	}
+
+	// the stream variant is given the remaining bytes
+	short := struct {
+		A uvarint
+	}{}
+	err := Unmarshal([]byte{0x80}, &short)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+
+	// the length of each Unmarshaler element can't be determined
+	elements := struct {
+		A [2]reversedBytes
+	}{}
+	err = Unmarshal(data, &elements)
+	assert.Equal(t, ErrLenRequired, errors.Cause(err))
+}
+
+// swappedPair is written with its values swapped but has no
+// UnmarshalBinary, so it's read using its fields.
+type swappedPair struct {
+	A, B uint8
+}
+
+func (p swappedPair) MarshalBinary() ([]byte, error) {
+	return []byte{p.B, p.A}, nil
+}
+
+// summedPair is read as the sum of its values but has no MarshalBinary,
+// so it's written using its fields.
+type summedPair struct {
+	A, B uint8
+}
+
+func (p *summedPair) UnmarshalBinary(data []byte) error {
+	p.A, p.B = data[0]+data[1], 0
+	return nil
+}
+
+func TestUnmarshalMarshalerOnly(t *testing.T) {
+	foo := struct {
+		A swappedPair
+		B [2]swappedPair
+	}{}
+	assert.NoError(t, Unmarshal([]byte{1, 2, 3, 4, 5, 6}, &foo))
+	assert.Equal(t, swappedPair{1, 2}, foo.A)
+	assert.Equal(t, [2]swappedPair{{3, 4}, {5, 6}}, foo.B)
+}
+
+func TestDecoderUnmarshaler(t *testing.T) {
+	type record struct {
+		A uvarint
+		B uint8
+	}
+	dec := NewDecoder(bytes.NewReader([]byte{0xAC, 0x02, 1, 0x05, 2}))
+	var a, b record
+	assert.NoError(t, dec.Decode(&a))
+	assert.Equal(t, record{300, 1}, a)
+	assert.NoError(t, dec.Decode(&b))
+	assert.Equal(t, record{5, 2}, b)
+}
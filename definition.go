@@ -1,14 +1,31 @@
 package binstruct
 
 import (
+	"encoding/binary"
+	"math/bits"
 	"reflect"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
 type structDefinition struct {
-	Type   reflect.Type
-	Fields map[string]*fieldDefinition
+	Type reflect.Type
+	// Fields are the struct's fields in declaration order.
+	Fields []*fieldDefinition
+	// names indexes the fields by name, excluding blank fields.
+	names map[string]*fieldDefinition
+	// Checksums are the fields holding checksums of other fields.
+	Checksums []*fieldDefinition
+	// HasChecksum determines whether the struct or any nested struct
+	// has checksum fields, which require the bytes to be read again.
+	HasChecksum bool
+	// parsing holds the definitions being parsed along with the struct,
+	// which is nil once parsed.
+	parsing map[reflect.Type]*structDefinition
+	// parsed determines whether the fields have been parsed, structs
+	// which are still being parsed contain the field being parsed.
+	parsed bool
 }
 
 // parseStruct creates a struct definition from the struct type.
@@ -17,46 +34,178 @@ func parseStruct(value interface{}) (*structDefinition, error) {
 	return parseStructType(t)
 }
 
+// definitionCache holds the struct definitions keyed by reflect.Type,
+// definitions aren't modified once parsed so they can be shared.
+var definitionCache sync.Map
+
+// cachedStructType returns the struct definition of the type from the
+// cache, parsing and caching the definition if it doesn't exist.
+func cachedStructType(t reflect.Type) (*structDefinition, error) {
+	if definition, ok := definitionCache.Load(t); ok {
+		return definition.(*structDefinition), nil
+	}
+	definition, parsed, err := parseStructTypes(t)
+	if err != nil {
+		return nil, err
+	}
+	// nested structs are only cached once the outermost struct has been
+	// parsed, as they may refer to the structs containing them
+	for nested, d := range parsed {
+		actual, _ := definitionCache.LoadOrStore(nested, d)
+		if nested == t {
+			definition = actual.(*structDefinition)
+		}
+	}
+	return definition, nil
+}
+
+// ClearCache removes the cached struct definitions, causing the struct
+// tags to be parsed again. The cache is cleared by SetDefaultOptions,
+// although it must be cleared manually if the default options are
+// modified after being set.
+func ClearCache() {
+	definitionCache.Range(func(key, _ interface{}) bool {
+		definitionCache.Delete(key)
+		return true
+	})
+}
+
 // parseStructType creates a struct definition from the type
 // detailing the fields and their options.
 func parseStructType(t reflect.Type) (*structDefinition, error) {
-	definition := &structDefinition{Type: t}
+	definition, _, err := parseStructTypes(t)
+	return definition, err
+}
+
+// parseStructTypes creates the struct definition of the type, also
+// returning the definitions of the uncached structs nested within it
+// keyed by their type.
+func parseStructTypes(t reflect.Type) (*structDefinition, map[reflect.Type]*structDefinition, error) {
+	parsing := make(map[reflect.Type]*structDefinition)
+	definition, err := parseNestedStructType(t, parsing)
+	if err != nil {
+		return nil, nil, err
+	}
+	// structs containing themselves saw the partially parsed definition,
+	// so checksums are propagated until none are left to propagate
+	for changed := true; changed; {
+		changed = false
+		for _, d := range parsing {
+			for _, f := range d.Fields {
+				if !d.HasChecksum && f.Children != nil && f.Children.HasChecksum {
+					d.HasChecksum, changed = true, true
+				}
+			}
+		}
+	}
+	for _, d := range parsing {
+		d.parsing = nil
+	}
+	return definition, parsing, nil
+}
+
+// parseNestedStructType creates the struct definition of the type,
+// adding it to the definitions being parsed before its fields so
+// structs containing themselves refer to the same definition.
+func parseNestedStructType(t reflect.Type, parsing map[reflect.Type]*structDefinition) (*structDefinition, error) {
+	definition := &structDefinition{Type: t, parsing: parsing}
+	parsing[t] = definition
 	if err := definition.parseFields(); err != nil {
 		return nil, err
 	}
+	definition.parsed = true
 	return definition, nil
 }
 
+// nestedStructType returns the definition of a struct nested within
+// the struct being parsed, which may be partially parsed when the
+// struct contains itself.
+func (s *structDefinition) nestedStructType(t reflect.Type) (*structDefinition, error) {
+	if definition, ok := s.parsing[t]; ok {
+		return definition, nil
+	}
+	if definition, ok := definitionCache.Load(t); ok {
+		return definition.(*structDefinition), nil
+	}
+	return parseNestedStructType(t, s.parsing)
+}
+
 // parseFields recursively iterates through the struct's fields
 // creating fieldDefinition.
 func (s *structDefinition) parseFields() error {
 	fieldCount := s.Type.NumField()
-	fieldDefinitions := make(map[string]*fieldDefinition, fieldCount)
+	// fields are added as they're parsed so options may only
+	// reference the fields declared before them
+	s.Fields = make([]*fieldDefinition, 0, fieldCount)
+	s.names = make(map[string]*fieldDefinition, fieldCount)
+	var unit *bitfieldUnit
 	for i := 0; i < fieldCount; i++ {
 		field := s.Type.Field(i)
 
-		var err error
 		// attempt to parse the field
-		if fieldDefinitions[field.Name], err = parseField(s, field); err != nil {
+		definition, err := parseField(s, field)
+		if err != nil {
 			return err
 		}
+		// consecutive bitfields share the same storage unit
+		if definition.Options.Bits != 0 {
+			if unit, err = packBitfield(definition, unit); err != nil {
+				return err
+			}
+		} else {
+			unit = nil
+		}
+		s.Fields = append(s.Fields, definition)
+		// blank fields can't be referenced by name
+		if field.Name != "_" {
+			s.names[field.Name] = definition
+		}
+		if definition.Checksum != nil {
+			s.Checksums = append(s.Checksums, definition)
+		}
+		if definition.Children != nil && definition.Children.HasChecksum {
+			s.HasChecksum = true
+		}
 	}
-	s.Fields = fieldDefinitions
-	return nil
+	// checksums may cover the fields which follow them
+	for _, f := range s.Checksums {
+		if err := s.resolveChecksum(f); err != nil {
+			return err
+		}
+		s.HasChecksum = true
+	}
+	return s.orderChecksums()
+}
+
+// fieldIndex returns the index of the field with the given name, or
+// -1 if the field doesn't exist.
+func (s *structDefinition) fieldIndex(name string) int {
+	for i, f := range s.Fields {
+		if f.Field.Name == name && name != "_" {
+			return i
+		}
+	}
+	return -1
+}
+
+// Field returns the field with the given name, or nil if the
+// field doesn't exist.
+func (s *structDefinition) Field(name string) *fieldDefinition {
+	return s.names[name]
 }
 
 // HasField determines whether the field name exists.
 func (s *structDefinition) HasField(name string) bool {
-	_, ok := s.Fields[name]
+	_, ok := s.names[name]
 	return ok
 }
 
 // HasFieldWithKind determines whether the field name exists and
 // the type-kind is equal to any of those given.
 func (s *structDefinition) HasFieldWithKind(name string, kinds ...reflect.Kind) bool {
-	if field, ok := s.Fields[name]; ok {
+	if field, ok := s.names[name]; ok {
 		for _, kind := range kinds {
-			if field.Field.Type.Kind() == kind {
+			if field.Type.Kind() == kind {
 				return true
 			}
 		}
@@ -65,11 +214,23 @@ func (s *structDefinition) HasFieldWithKind(name string, kinds ...reflect.Kind)
 }
 
 type fieldDefinition struct {
-	Struct   *structDefinition
-	Field    reflect.StructField
-	Type     reflect.Type
-	Options  *FieldOptions
-	Children *structDefinition
+	Struct    *structDefinition
+	Field     reflect.StructField
+	Type      reflect.Type
+	Options   *FieldOptions
+	Children  *structDefinition
+	Bitfield  *bitfield
+	Condition *condition
+	Sentinel  *sentinel
+	Encoding  TextEncoding
+	Fixed     *fixedPoint
+	Checksum  *checksumRange
+	Const     reflect.Value
+	Enum      *enum
+	// Recursive determines whether the field's struct contains the
+	// struct holding the field, so nil pointers can't be written as
+	// the zero value of the struct.
+	Recursive bool
 }
 
 // numericalFieldKinds contains a list of the valid kinds when
@@ -82,9 +243,32 @@ var numericalFieldKinds = []reflect.Kind{
 var (
 	ErrTagParseFailed           = errors.New("failed to parse field tag")
 	ErrOptionLenFieldInvalid    = errors.New("tag option lenfield must be an integer")
+	ErrOptionLenRestInvalid     = errors.New("tag option len=rest must be used with fixed strings, slices or Unmarshalers without lenfield")
 	ErrOptionOffsetFieldInvalid = errors.New("tag option offsetfield must be an integer")
+	ErrOptionSizeFieldInvalid   = errors.New("tag option sizefield must be an integer used with struct fields")
+	ErrOptionStringTypeInvalid  = errors.New("tag option stringtype is not a known string type")
+	ErrOptionEndianInvalid      = errors.New("tag option endian must be either big or little")
+	ErrOptionEndianFieldInvalid = errors.New("tag option endianfield must be a boolean or an integer of at least 2 bytes")
+	ErrInvalidByteOrderMark     = errors.New("endianfield value is not a byte order mark")
 )
 
+// fieldReferenceError is returned when a tag option references a
+// sibling field which is missing or has an unusable type.
+type fieldReferenceError struct {
+	Option string
+	Name   string
+	cause  error
+}
+
+func (e *fieldReferenceError) Error() string {
+	return "cannot use field " + e.Name + " for " + e.Option
+}
+
+// Cause returns the sentinel error describing the option requirement.
+func (e *fieldReferenceError) Cause() error {
+	return e.cause
+}
+
 // parseField creates a field definition from the given
 // field type belonging to the struct.
 func parseField(s *structDefinition, field reflect.StructField) (*fieldDefinition, error) {
@@ -96,6 +280,16 @@ func parseField(s *structDefinition, field reflect.StructField) (*fieldDefinitio
 	if err := definition.parseTag(); err != nil {
 		return nil, err
 	}
+	// nested structs, and slices or arrays of structs, are
+	// described by their own definition unless they marshal themselves
+	// in both directions
+	if t := elementType(definition.Type); t.Kind() == reflect.Struct && !(implementsMarshaler(t) && implementsUnmarshaler(t)) && t != lazyType {
+		var err error
+		if definition.Children, err = s.nestedStructType(t); err != nil {
+			return nil, err
+		}
+		definition.Recursive = !definition.Children.parsed
+	}
 	return definition, nil
 }
 
@@ -107,17 +301,229 @@ func (f *fieldDefinition) parseTag() error {
 		return errors.Wrap(err, ErrTagParseFailed.Error())
 	}
 
+	switch f.Options.StringType {
+	case StringFixed, StringNullTerminated:
+	default:
+		if stringPrefixSize(f.Options.StringType) == 0 && !isVarint(f.Options.StringType) {
+			return ErrOptionStringTypeInvalid
+		}
+	}
+	var ok bool
+	if f.Encoding, ok = lookupEncoding(f.Options.Encoding); !ok {
+		return ErrOptionEncodingInvalid
+	}
+	if f.Options.IntType != IntFixed {
+		if !isVarint(f.Options.IntType) || f.Options.Bits != 0 || !isInteger(elementType(f.Type).Kind()) {
+			return ErrOptionIntInvalid
+		}
+	}
+
+	if f.Options.Len == LenRest {
+		kind := f.Type.Kind()
+		if kind != reflect.Slice && kind != reflect.String && !implementsMarshaling(f.Type) ||
+			kind == reflect.String && f.Options.StringType != StringFixed || f.Options.LenField != "" {
+			return ErrOptionLenRestInvalid
+		}
+	}
+	if f.Options.LenPrefix != "" {
+		if lenPrefixSize(f.Options.LenPrefix) == 0 && !isVarint(f.Options.LenPrefix) ||
+			f.Type.Kind() != reflect.Slice || f.Options.Len != 0 || f.Options.LenField != "" {
+			return ErrOptionLenPrefixInvalid
+		}
+	}
+	if f.Options.Until != "" {
+		if f.Sentinel, err = parseSentinel(f); err != nil {
+			return err
+		}
+	}
+	if f.Options.LenUnit != LenUnitCount && f.Options.LenUnit != LenUnitBytes {
+		return ErrOptionLenUnitInvalid
+	}
+	if f.Options.Float != "" {
+		switch f.Options.Float {
+		case Float16, Float32, Float64:
+		default:
+			return ErrOptionFloatInvalid
+		}
+		if !isFloat(elementType(f.Type).Kind()) || f.Options.Fixed != "" {
+			return ErrOptionFloatInvalid
+		}
+	}
+	if f.Options.Fixed != "" {
+		if !isFloat(elementType(f.Type).Kind()) {
+			return ErrOptionFixedInvalid
+		}
+		if f.Fixed, err = parseFixedPoint(f.Options.Fixed); err != nil {
+			return err
+		}
+	}
+	if elementType(f.Type) == lazyType && f.Type != lazyType {
+		return ErrLazyElement
+	}
+	if f.Options.Ptr != "" {
+		t := f.Field.Type
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		if lenPrefixSize(f.Options.Ptr) == 0 || t.Kind() != reflect.Ptr || f.Options.Bits != 0 ||
+			f.Options.Until != "" || f.Options.Len == LenRest || f.Options.LenUnit != LenUnitCount ||
+			f.Options.SizeField != "" || f.Options.Const != "" {
+			return ErrOptionPtrInvalid
+		}
+	}
+	switch f.Options.Rel {
+	case RelFile, RelParent, RelSelf:
+	default:
+		return ErrOptionRelInvalid
+	}
+	if f.Options.Const != "" {
+		if f.Const, err = parseConst(f); err != nil {
+			return err
+		}
+	}
+	if f.Options.Enum != EnumStrict && f.Options.Enum != EnumLenient {
+		return ErrOptionEnumInvalid
+	}
+	f.Enum = lookupEnum(elementType(f.Type))
+	// the default mode applies to the enums among all fields, although
+	// fields tagged as strict must be enums
+	if f.Enum == nil && f.Options.Enum == EnumStrict && tag.Contains("enum") {
+		return ErrEnumUnregistered
+	}
+	if f.Options.Checksum != "" {
+		fn, ok := lookupChecksum(f.Options.Checksum)
+		if !ok || !isInteger(f.Type.Kind()) || f.Options.Bits != 0 || f.Field.PkgPath != "" {
+			return ErrOptionChecksumInvalid
+		}
+		if f.Options.Over == "" {
+			return ErrOptionOverInvalid
+		}
+		f.Checksum = &checksumRange{Algorithm: f.Options.Checksum, Func: fn}
+	} else if f.Options.Over != "" {
+		return ErrOptionOverInvalid
+	}
+	if byteOrder(f.Options.Endian) == nil {
+		return ErrOptionEndianInvalid
+	}
+	if f.Options.BitOrder != BitOrderMSB && f.Options.BitOrder != BitOrderLSB {
+		return ErrOptionBitOrderInvalid
+	}
+
 	// ensure the options referencing other fields exist and are valid
 	if f.Options.LenField != "" {
 		if !f.Struct.HasFieldWithKind(f.Options.LenField, numericalFieldKinds...) {
-			return ErrOptionLenFieldInvalid
+			return &fieldReferenceError{"lenfield", f.Options.LenField, ErrOptionLenFieldInvalid}
 		}
 	}
 	if f.Options.OffsetField != "" {
 		if !f.Struct.HasFieldWithKind(f.Options.OffsetField, numericalFieldKinds...) {
-			return ErrOptionOffsetFieldInvalid
+			return &fieldReferenceError{"offsetfield", f.Options.OffsetField, ErrOptionOffsetFieldInvalid}
+		}
+	}
+	if f.Options.SizeField != "" {
+		if f.Type.Kind() != reflect.Struct {
+			return ErrOptionSizeFieldInvalid
+		}
+		if !f.Struct.HasFieldWithKind(f.Options.SizeField, numericalFieldKinds...) {
+			return &fieldReferenceError{"sizefield", f.Options.SizeField, ErrOptionSizeFieldInvalid}
+		}
+	}
+	if f.Options.EndianField != "" {
+		// byte order marks don't fit in single byte integers
+		kinds := []reflect.Kind{
+			reflect.Bool,
+			reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		}
+		if !f.Struct.HasFieldWithKind(f.Options.EndianField, kinds...) {
+			return &fieldReferenceError{"endianfield", f.Options.EndianField, ErrOptionEndianFieldInvalid}
+		}
+	}
+	if f.Options.If != "" {
+		if f.Options.Bits != 0 {
+			return ErrOptionIfBitfield
+		}
+		if f.Condition, err = parseCondition(f.Options.If); err != nil {
+			return err
+		}
+		kinds := append([]reflect.Kind{reflect.Bool}, numericalFieldKinds...)
+		if !f.Struct.HasFieldWithKind(f.Condition.Field, kinds...) {
+			return &fieldReferenceError{"if", f.Condition.Field, ErrOptionIfFieldInvalid}
+		}
+	}
+	if f.Options.Switch != "" {
+		if f.Type.Kind() != reflect.Interface {
+			return ErrSwitchNotInterface
+		}
+		if !f.Struct.HasFieldWithKind(f.Options.Switch, numericalFieldKinds...) {
+			return &fieldReferenceError{"switch", f.Options.Switch, ErrOptionSwitchInvalid}
 		}
 	}
 
 	return nil
 }
+
+// byteOrder returns the byte order of the field's value, either selected
+// by the EndianField sibling, set by the Endian option, or inherited from
+// the parent's byte order.
+func (f *fieldDefinition) byteOrder(parent reflect.Value, inherited binary.ByteOrder) (binary.ByteOrder, error) {
+	name := f.Options.EndianField
+	if name == "" {
+		if f.Options.Endian == "" {
+			return inherited, nil
+		}
+		return byteOrder(f.Options.Endian), nil
+	}
+	value := dereference(parent.FieldByName(name))
+	if value.Kind() == reflect.Bool {
+		if value.Bool() {
+			return binary.BigEndian, nil
+		}
+		return binary.LittleEndian, nil
+	}
+	// the mark is read using the byte order of the sibling, reading the
+	// swapped mark means the opposite byte order is used
+	order := inherited
+	if sibling := f.Struct.Field(name); sibling.Options.Endian != "" {
+		order = byteOrder(sibling.Options.Endian)
+	}
+	size := kindSize(value.Kind())
+	switch uint64(intValue(value)) & (1<<uint(size*8) - 1) {
+	case ByteOrderMark:
+		return order, nil
+	case bits.ReverseBytes64(ByteOrderMark) >> uint(64-size*8):
+		if order == binary.BigEndian {
+			return binary.LittleEndian, nil
+		}
+		return binary.BigEndian, nil
+	}
+	return nil, ErrInvalidByteOrderMark
+}
+
+// implementsMarshaling determines whether the type, or a pointer to
+// the type, implements any of the marshaling interfaces.
+func implementsMarshaling(t reflect.Type) bool {
+	for _, i := range []reflect.Type{marshalerType, unmarshalerType, readerUnmarshalerType} {
+		if t.Implements(i) || reflect.PtrTo(t).Implements(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// implementsMarshaler determines whether the type, or a pointer to the
+// type, implements Marshaler.
+func implementsMarshaler(t reflect.Type) bool {
+	return t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType)
+}
+
+// implementsUnmarshaler determines whether the type, or a pointer to
+// the type, implements Unmarshaler or ReaderUnmarshaler.
+func implementsUnmarshaler(t reflect.Type) bool {
+	for _, i := range []reflect.Type{unmarshalerType, readerUnmarshalerType} {
+		if t.Implements(i) || reflect.PtrTo(t).Implements(i) {
+			return true
+		}
+	}
+	return false
+}
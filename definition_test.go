@@ -2,6 +2,7 @@ package binstruct
 
 import (
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -68,3 +69,175 @@ func TestParseStructInvalidTagValue(t *testing.T) {
 	_, err := parseStruct(foo)
 	assert.EqualError(t, errors.Cause(err), ErrInvalidTagInt64.Error())
 }
+
+func TestParseStructInvalidStringType(t *testing.T) {
+	foo := struct {
+		A string `binstruct:"stringtype=foo"`
+	}{}
+	_, err := parseStruct(foo)
+	assert.Equal(t, ErrOptionStringTypeInvalid, err)
+}
+
+func TestParseStructChildren(t *testing.T) {
+	type bar struct {
+		X int32
+	}
+	foo := struct {
+		A bar
+		B []bar
+		C [2]*bar
+		D int32
+	}{}
+	definition, err := parseStruct(foo)
+	assert.NoError(t, err)
+	for _, name := range []string{"A", "B", "C"} {
+		if assert.NotNil(t, definition.Field(name).Children) {
+			assert.Equal(t, resolveType(bar{}), definition.Field(name).Children.Type)
+		}
+	}
+	assert.Nil(t, definition.Field("D").Children)
+}
+
+func TestParseStructInvalidEndian(t *testing.T) {
+	foo := struct {
+		A int32 `binstruct:"endian=middle"`
+	}{}
+	_, err := parseStruct(foo)
+	assert.Equal(t, ErrOptionEndianInvalid, err)
+}
+
+func TestParseStructInvalidEndianFieldReference(t *testing.T) {
+	foo := struct {
+		A string
+		B int32 `binstruct:"endianfield=A"`
+	}{}
+	_, err := parseStruct(foo)
+	assert.EqualError(t, err, "cannot use field A for endianfield")
+}
+
+func TestParseStructSingleByteEndianFieldReference(t *testing.T) {
+	// byte order marks don't fit in a single byte
+	foo := struct {
+		A uint8
+		B int32 `binstruct:"endianfield=A"`
+	}{}
+	_, err := parseStruct(foo)
+	assert.EqualError(t, err, "cannot use field A for endianfield")
+	assert.Equal(t, ErrOptionEndianFieldInvalid, errors.Cause(err))
+
+	bar := struct {
+		A int8
+		B int32 `binstruct:"endianfield=A"`
+	}{}
+	_, err = parseStruct(bar)
+	assert.Equal(t, ErrOptionEndianFieldInvalid, errors.Cause(err))
+}
+
+func TestCachedStructType(t *testing.T) {
+	type foo struct {
+		A int32
+		B struct {
+			C int32
+		}
+	}
+	fooType := resolveType(foo{})
+	a, err := cachedStructType(fooType)
+	assert.NoError(t, err)
+	b, err := cachedStructType(fooType)
+	assert.NoError(t, err)
+	assert.True(t, a == b)
+
+	// children are shared with the cached definition of their type
+	child, err := cachedStructType(a.Field("B").Type)
+	assert.NoError(t, err)
+	assert.True(t, a.Field("B").Children == child)
+
+	ClearCache()
+	c, err := cachedStructType(fooType)
+	assert.NoError(t, err)
+	assert.False(t, a == c)
+}
+
+func TestCachedStructTypeRecursive(t *testing.T) {
+	type node struct {
+		Value uint8
+		Next  *node `binstruct:"ptr=uint8"`
+	}
+	// the field refers to the definition containing it
+	definition, err := cachedStructType(resolveType(node{}))
+	assert.NoError(t, err)
+	assert.True(t, definition.Field("Next").Children == definition)
+
+	// structs containing each other have checksums propagated to both
+	type inner struct {
+		Sum   uint8 `binstruct:"checksum=sum8,over=Value"`
+		Value uint8
+		Outer []struct {
+			Inner *inner `binstruct:"ptr=uint8"`
+		} `binstruct:"len=1"`
+	}
+	definition, err = parseStruct(inner{})
+	assert.NoError(t, err)
+	assert.True(t, definition.Field("Outer").Children.HasChecksum)
+}
+
+func TestCachedStructTypeDefaultOptions(t *testing.T) {
+	type foo struct {
+		A string
+	}
+	fooType := resolveType(foo{})
+	a, err := cachedStructType(fooType)
+	assert.NoError(t, err)
+	assert.Equal(t, StringFixed, a.Field("A").Options.StringType)
+
+	defer SetDefaultOptions(defaultFieldOptions)
+	options := &FieldOptions{}
+	*options = *defaultFieldOptions
+	options.StringType = StringNullTerminated
+	SetDefaultOptions(options)
+
+	b, err := cachedStructType(fooType)
+	assert.NoError(t, err)
+	assert.Equal(t, StringNullTerminated, b.Field("A").Options.StringType)
+}
+
+func TestCachedStructTypeConcurrent(t *testing.T) {
+	type foo struct {
+		A int32
+	}
+	fooType := resolveType(foo{})
+	var wg sync.WaitGroup
+	definitions := make([]*structDefinition, 8)
+	for i := range definitions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			definitions[i], _ = cachedStructType(fooType)
+		}(i)
+	}
+	wg.Wait()
+	for _, definition := range definitions {
+		assert.True(t, definitions[0] == definition)
+	}
+}
+
+func TestParseStructFieldOrder(t *testing.T) {
+	foo := struct {
+		Z int8
+		A int8
+		_ uint8 `binstruct:"bits=2"`
+		M int8  `binstruct:"bits=4"`
+		_ uint8 `binstruct:"bits=2"`
+	}{}
+	definition, err := parseStruct(foo)
+	assert.NoError(t, err)
+	var names []string
+	for _, field := range definition.Fields {
+		names = append(names, field.Field.Name)
+	}
+	assert.Equal(t, []string{"Z", "A", "_", "M", "_"}, names)
+	assert.True(t, definition.Field("A") == definition.Fields[1])
+	assert.Nil(t, definition.Field("_"))
+	assert.Nil(t, definition.Field("B"))
+	assert.Equal(t, uint(2), definition.Field("M").Bitfield.Shift)
+}
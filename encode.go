@@ -1,9 +1,505 @@
 package binstruct
 
+import (
+	"encoding/binary"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Marshaler provides an interface for types to marshal themselves to binary.
+// When a field's type implements Marshaler the bytes returned by
+// MarshalBinary are written, padded to the field's Len if set.
 type Marshaler interface {
 	MarshalBinary() ([]byte, error)
 }
 
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// marshaler returns the value as a Marshaler if either the value's type
+// or a pointer to the type implements the interface.
+func marshaler(v reflect.Value) (Marshaler, bool) {
+	if v.Type().Implements(marshalerType) {
+		return v.Interface().(Marshaler), true
+	}
+	if reflect.PtrTo(v.Type()).Implements(marshalerType) {
+		if !v.CanAddr() {
+			// copy the value so its pointer can be taken
+			p := reflect.New(v.Type())
+			p.Elem().Set(v)
+			return p.Interface().(Marshaler), true
+		}
+		return v.Addr().Interface().(Marshaler), true
+	}
+	return nil, false
+}
+
+var (
+	ErrInvalidMarshalValue = errors.New("marshal value must be a struct or a non-nil pointer to a struct")
+	ErrLenExceeded         = errors.New("field value exceeds the maximum length")
+	ErrLenMismatch         = errors.New("fields sharing a lenfield have different lengths")
+	ErrBackfillSize        = errors.New("back-filled field changed size, the value must be known before encoding")
+	ErrNilRecursive        = errors.New("nil pointers to structs containing themselves can't be encoded without the ptr option")
+)
+
+// Marshal returns the binary encoding of the struct v.
 func Marshal(v interface{}) ([]byte, error) {
-	return nil, nil
+	value, definition, err := marshalTarget(v)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bufferSink{}
+	e := newEncoder(buf)
+	if err := e.encode(definition, value); err != nil {
+		return nil, err
+	}
+	return buf.buf, nil
+}
+
+// marshalTarget resolves the struct value of v and its definition.
+func marshalTarget(v interface{}) (reflect.Value, *structDefinition, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return reflect.Value{}, nil, ErrInvalidMarshalValue
+	}
+	value = dereference(value)
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, nil, ErrInvalidMarshalValue
+	}
+	definition, err := cachedStructType(value.Type())
+	if err != nil {
+		return reflect.Value{}, nil, err
+	}
+	return value, definition, nil
+}
+
+// encoder writes values to the sink as described by the struct
+// and field definitions.
+type encoder struct {
+	dst   sink
+	pos   int64
+	order binary.ByteOrder
+	// end is the position following the bytes written.
+	end int64
+	// start is the position of the struct being written.
+	start int64
+	// pointers are the pointers whose pointees haven't been written.
+	pointers []*pointer
+}
+
+// newEncoder creates an encoder writing to the start of the sink.
+func newEncoder(dst sink) *encoder {
+	return &encoder{
+		dst:   dst,
+		order: byteOrder(defaultFieldOptions.Endian),
+	}
+}
+
+// write writes the bytes at the current position and advances the
+// position, any gap before the position is filled with null bytes.
+func (e *encoder) write(b []byte) error {
+	if err := e.dst.writeAt(e.pos, b); err != nil {
+		return err
+	}
+	e.pos += int64(len(b))
+	if e.pos > e.end {
+		e.end = e.pos
+	}
+	return nil
+}
+
+// writeUint writes an unsigned integer of the given size in bytes.
+func (e *encoder) writeUint(size int, value uint64) error {
+	b := make([]byte, size)
+	switch size {
+	case 1:
+		b[0] = byte(value)
+	case 2:
+		e.order.PutUint16(b, uint16(value))
+	case 4:
+		e.order.PutUint32(b, uint32(value))
+	case 8:
+		e.order.PutUint64(b, value)
+	default:
+		return ErrUnsupportedKind
+	}
+	return e.write(b)
+}
+
+// writeInteger writes the bits of a signed or unsigned integer of
+// the kind using the field's integer type.
+func (e *encoder) writeInteger(f *fieldDefinition, kind reflect.Kind, value uint64) error {
+	if isVarint(f.Options.IntType) {
+		return e.writeVarint(f.Options.IntType, value)
+	}
+	return e.writeUint(kindSize(kind), value)
+}
+
+// writePrefix writes the length prefix of the string type.
+func (e *encoder) writePrefix(t StringType, n int64) error {
+	if isVarint(t) {
+		return e.writeVarint(t, uint64(n))
+	}
+	size := stringPrefixSize(t)
+	if size < 8 && n >= 1<<uint(size*8-1) {
+		return ErrLenExceeded
+	}
+	return e.writeUint(size, uint64(n))
+}
+
+// encode encodes the struct followed by the pointees of its pointers.
+func (e *encoder) encode(s *structDefinition, v reflect.Value) error {
+	if err := e.encodeStruct(s, v); err != nil {
+		return err
+	}
+	return e.layoutPointers()
+}
+
+// encodeStruct encodes each of the struct's fields in the order
+// they're declared, the fields referenced by lenfield, offsetfield,
+// sizefield and switch are back-filled once the values have been
+// written.
+func (e *encoder) encodeStruct(s *structDefinition, v reflect.Value) error {
+	outer := e.start
+	e.start = e.pos
+	defer func() { e.start = outer }()
+
+	// work on a copy so the referenced fields can be back-filled
+	// without modifying the value being marshalled
+	value := reflect.New(s.Type).Elem()
+	value.Set(v)
+
+	if err := e.prefill(s, value); err != nil {
+		return err
+	}
+	extents := make(map[string]fieldExtent, len(s.Fields))
+	lengths := make(map[string]int64)
+	for _, f := range s.Fields {
+		if f.Condition != nil && !f.Condition.Evaluate(value) {
+			continue
+		}
+		if f.Bitfield != nil && !f.Bitfield.First(f) {
+			// bitfields are written along with the first in their
+			// unit, back-filling the field rewrites the whole unit
+			extents[f.Field.Name] = extents[f.Bitfield.Unit.Fields[0].Field.Name]
+			continue
+		}
+		extent, err := e.encodeField(f, value)
+		if err != nil {
+			return e.fieldError(err, f.Field.Name)
+		}
+		extents[f.Field.Name] = extent
+
+		if name := f.Options.OffsetField; name != "" {
+			if err := e.backfill(s, value, extents[name], name, extent.Start); err != nil {
+				return err
+			}
+		}
+		if name := f.Options.LenField; name != "" {
+			n := valueLen(f, value.FieldByIndex(f.Field.Index), extent)
+			if previous, ok := lengths[name]; ok && previous != n {
+				return e.fieldError(ErrLenMismatch, f.Field.Name)
+			}
+			lengths[name] = n
+			if err := e.backfill(s, value, extents[name], name, n); err != nil {
+				return err
+			}
+		}
+		if name := f.Options.SizeField; name != "" {
+			if err := e.backfill(s, value, extents[name], name, extent.End-extent.Value); err != nil {
+				return err
+			}
+		}
+		if name := f.Options.Switch; name != "" {
+			discriminator, err := variantDiscriminator(value.FieldByIndex(f.Field.Index))
+			if err != nil {
+				return e.fieldError(err, f.Field.Name)
+			}
+			if err := e.backfill(s, value, extents[name], name, discriminator); err != nil {
+				return err
+			}
+		}
+	}
+	// checksums are computed once the bytes of their range are final
+	for _, f := range s.Checksums {
+		extent, ok := extents[f.Field.Name]
+		if !ok {
+			continue
+		}
+		start, end := f.Checksum.bounds(s, extents)
+		b, err := e.dst.readBack(start, end-start)
+		if err != nil {
+			return e.fieldError(err, f.Field.Name)
+		}
+		if err := e.backfill(s, value, extent, f.Field.Name, int64(f.Checksum.Func(b))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefill sets the lengths and discriminators known before encoding,
+// so variable-length integers referenced by later fields are written
+// with their final size.
+func (e *encoder) prefill(s *structDefinition, value reflect.Value) error {
+	for _, f := range s.Fields {
+		if f.Condition != nil && !f.Condition.Evaluate(value) {
+			continue
+		}
+		v := value.FieldByIndex(f.Field.Index)
+		if name := f.Options.LenField; name != "" {
+			v := dereference(v)
+			if _, ok := marshaler(v); ok {
+				// the length is known once the value has been marshalled
+			} else if v.Kind() == reflect.Slice && f.Options.LenUnit != LenUnitBytes {
+				setIntValue(value.FieldByName(name), int64(v.Len()))
+			} else if v.Kind() == reflect.String {
+				b, err := f.Encoding.Encode(v.String())
+				if err != nil {
+					return e.fieldError(err, f.Field.Name)
+				}
+				setIntValue(value.FieldByName(name), f.stringLen(int64(len(b))))
+			}
+		}
+		if name := f.Options.Switch; name != "" {
+			discriminator, err := variantDiscriminator(v)
+			if err != nil {
+				return e.fieldError(err, f.Field.Name)
+			}
+			setIntValue(value.FieldByName(name), discriminator)
+		}
+	}
+	return nil
+}
+
+// fieldExtent describes the position of an encoded field.
+type fieldExtent struct {
+	// Start is the position before the field's skip and alignment
+	// are applied, and is used as the field's offset.
+	Start int64
+	// Value is the position of the field's value.
+	Value int64
+	// End is the position following the field's value.
+	End int64
+}
+
+// valueLen returns the length of the field's value, which is the
+// number of elements for slices, the number of code units for strings,
+// otherwise the number of bytes written.
+func valueLen(f *fieldDefinition, v reflect.Value, extent fieldExtent) int64 {
+	v = dereference(v)
+	if _, ok := marshaler(v); !ok {
+		switch v.Kind() {
+		case reflect.Slice:
+			if f.Options.LenUnit != LenUnitBytes {
+				return int64(v.Len())
+			}
+		case reflect.String:
+			return f.stringLen(extent.End - extent.Value)
+		}
+	}
+	return extent.End - extent.Value
+}
+
+// backfill sets the sibling field to the value now known and
+// rewrites it at its original position.
+func (e *encoder) backfill(s *structDefinition, parent reflect.Value, extent fieldExtent, name string, value int64) error {
+	end := e.pos
+	setIntValue(parent.FieldByName(name), value)
+	e.pos = extent.Start
+	f := s.Field(name)
+	if f.Bitfield != nil {
+		// bitfields are rewritten along with their unit, positioned by
+		// the first field in the unit
+		f = f.Bitfield.Unit.Fields[0]
+	}
+	rewritten, err := e.encodeField(f, parent)
+	if err != nil {
+		return e.fieldError(err, name)
+	}
+	if rewritten.End != extent.End {
+		return e.fieldError(ErrBackfillSize, name)
+	}
+	e.pos = end
+	return nil
+}
+
+// fieldError wraps the error with the path of the field or element
+// being encoded.
+func (e *encoder) fieldError(err error, name string) error {
+	return wrapFieldError(err, "encode", name, e.pos)
+}
+
+// encodeField positions the encoder as specified by the field
+// options and encodes the field's value.
+func (e *encoder) encodeField(f *fieldDefinition, parent reflect.Value) (fieldExtent, error) {
+	options := f.Options
+	if options.OffsetField == "" && options.Offset != 0 {
+		e.pos = options.Offset
+	}
+	extent := fieldExtent{Start: e.pos}
+	e.pos += options.Skip
+	if options.Align {
+		e.pos = align(e.pos, options.AlignBytes)
+	}
+	if e.pos < 0 {
+		return extent, ErrNegativePosition
+	}
+	// ensure skipped and aligned bytes exist in the output
+	if err := e.write(nil); err != nil {
+		return extent, err
+	}
+	order, err := f.byteOrder(parent, e.order)
+	if err != nil {
+		return extent, err
+	}
+	// the byte order is inherited by nested structs
+	inherited := e.order
+	e.order = order
+	defer func() { e.order = inherited }()
+
+	extent.Value = e.pos
+	if f.Bitfield != nil {
+		err = e.encodeBitfield(f.Bitfield.Unit, parent)
+	} else if options.Ptr != "" {
+		err = e.encodePointers(f, fieldValue(f, parent))
+	} else if f.Type == lazyType {
+		err = e.encodeLazy(f, dereference(fieldValue(f, parent)).Interface().(Lazy))
+	} else if f.Const.IsValid() {
+		// constants are written regardless of the field's value
+		err = e.encodeValue(f, f.Const)
+	} else if v := fieldValue(f, parent); f.Recursive && isNilPointer(v) {
+		err = ErrNilRecursive
+	} else {
+		err = e.encodeValue(f, dereference(v))
+	}
+	extent.End = e.pos
+	return extent, err
+}
+
+// encodeBitfield packs the values of the unit's fields and writes
+// the storage unit.
+func (e *encoder) encodeBitfield(unit *bitfieldUnit, parent reflect.Value) error {
+	var value uint64
+	for _, f := range unit.Fields {
+		var err error
+		v := dereference(parent.FieldByIndex(f.Field.Index))
+		if value, err = f.Bitfield.pack(value, v); err != nil {
+			return e.fieldError(err, f.Field.Name)
+		}
+	}
+	return e.writeUint(unit.Size, value)
+}
+
+// encodeValue encodes the value of the field.
+func (e *encoder) encodeValue(f *fieldDefinition, v reflect.Value) error {
+	if m, ok := marshaler(v); ok {
+		b, err := m.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if f.Options.LenField == "" && f.Options.Len > 0 {
+			if int64(len(b)) > f.Options.Len {
+				return ErrLenExceeded
+			}
+			// pad the remainder of the fixed length
+			b = append(b, make([]byte, f.Options.Len-int64(len(b)))...)
+		}
+		return e.write(b)
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if f.Options.Switch == "" {
+			return ErrUnsupportedKind
+		}
+		return e.encodeVariant(f, v)
+	case reflect.String:
+		return e.encodeString(f, v)
+	case reflect.Slice:
+		return e.encodeSlice(f, v)
+	}
+	return e.encodeElement(f, v)
+}
+
+// encodeElement encodes values which don't depend on sibling
+// fields, such as numbers, nested structs and the elements of
+// slices and arrays.
+func (e *encoder) encodeElement(f *fieldDefinition, v reflect.Value) error {
+	if f.Recursive && isNilPointer(v) {
+		return ErrNilRecursive
+	}
+	v = dereference(v)
+	if m, ok := marshaler(v); ok {
+		b, err := m.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return e.write(b)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		var value uint64
+		if v.Bool() {
+			value = 1
+		}
+		return e.writeUint(1, value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if err := f.checkEnum(v); err != nil {
+			return err
+		}
+		return e.writeInteger(f, v.Kind(), uint64(v.Int())|f.Options.Mask)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if err := f.checkEnum(v); err != nil {
+			return err
+		}
+		return e.writeInteger(f, v.Kind(), v.Uint()|f.Options.Mask)
+	case reflect.Float32, reflect.Float64:
+		return e.writeFloat(f, v.Kind(), v.Float())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeElement(f, v.Index(i)); err != nil {
+				return e.fieldError(err, indexName(i))
+			}
+		}
+		return nil
+	case reflect.Struct:
+		if f.Children == nil {
+			return ErrUnsupportedKind
+		}
+		return e.encodeStruct(f.Children, v)
+	}
+	return ErrUnsupportedKind
+}
+
+// encodeString encodes a string value using the field's string type.
+func (e *encoder) encodeString(f *fieldDefinition, v reflect.Value) error {
+	b, err := f.Encoding.Encode(v.String())
+	if err != nil {
+		return err
+	}
+	switch f.Options.StringType {
+	case StringFixed:
+		if f.Options.LenField != "" || f.Options.Len == LenRest {
+			return e.write(b)
+		}
+		if f.Options.Len == 0 {
+			return ErrLenRequired
+		}
+		size := f.stringSize(f.Options.Len)
+		if int64(len(b)) > size {
+			return ErrLenExceeded
+		}
+		// pad the remainder of the fixed-length string
+		for i := int64(len(b)); i < size; i++ {
+			b = append(b, f.Options.StringPad)
+		}
+		return e.write(b)
+	case StringNullTerminated:
+		return e.write(append(b, make([]byte, f.Encoding.UnitSize())...))
+	default:
+		if err := e.writePrefix(f.Options.StringType, f.stringLen(int64(len(b)))); err != nil {
+			return err
+		}
+		return e.write(b)
+	}
 }
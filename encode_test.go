@@ -0,0 +1,218 @@
+package binstruct
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalNumbers(t *testing.T) {
+	h := int16(3)
+	foo := struct {
+		A int8
+		B uint16
+		C int32
+		D uint64
+		E bool
+		F float32
+		G float64
+		H *int16
+		I *int16
+	}{-1, 0x0201, -2, 1, true, 1.5, 2.5, &h, nil}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0xFF,
+		0x01, 0x02,
+		0xFE, 0xFF, 0xFF, 0xFF,
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01,
+		0x00, 0x00, 0xC0, 0x3F,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x40,
+		0x03, 0x00,
+		0x00, 0x00,
+	}, data)
+}
+
+func TestMarshalStrings(t *testing.T) {
+	foo := struct {
+		A string `binstruct:"len=4"`
+		B string `binstruct:"len=4,stringpad=x"`
+		C string `binstruct:"stringtype=null"`
+		D string `binstruct:"stringtype=int16"`
+		E uint8
+		F string `binstruct:"lenfield=E"`
+	}{"ab", "cd", "ef", "gh", 0, "ijk"}
+	data, err := Marshal(&foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ab\x00\x00cdxxef\x00\x02\x00gh\x03ijk"), data)
+	// the marshalled value is left unmodified
+	assert.Equal(t, uint8(0), foo.E)
+}
+
+func TestMarshalPositioning(t *testing.T) {
+	foo := struct {
+		A uint8
+		B uint8 `binstruct:"skip=1"`
+		C uint8 `binstruct:"align,alignbytes=4"`
+		D uint8 `binstruct:"offset=6"`
+		E uint8 `binstruct:"offsetfield=A"`
+		F uint8
+	}{0, 2, 3, 4, 5, 6}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{7, 0, 2, 0, 3, 0, 4, 5, 6}, data)
+}
+
+func TestMarshalBlankFields(t *testing.T) {
+	foo := struct {
+		A uint8
+		_ [2]byte
+		B uint8
+		_ uint16 `binstruct:"skip=1"`
+		C uint8
+		d uint8
+	}{A: 1, B: 2, C: 3, d: 4}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0, 0, 2, 0, 0, 0, 3, 0}, data)
+
+	// unexported fields are zeroed like blank fields
+	bar := struct {
+		A        uint8
+		reserved uint16
+		B        uint8
+	}{1, 0xFFFF, 2}
+	data, err = Marshal(bar)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0, 0, 2}, data)
+}
+
+func TestMarshalMask(t *testing.T) {
+	foo := struct {
+		A uint16 `binstruct:"mask=0x8000"`
+	}{1}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x80}, data)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	type bar struct {
+		X uint8
+		Y string `binstruct:"stringtype=int8"`
+	}
+	type foo struct {
+		Count   uint16
+		Offset  uint32
+		Name    string `binstruct:"len=8,stringpad=_"`
+		Items   []bar  `binstruct:"lenfield=Count"`
+		Fixed   [2]int16
+		Padding []byte `binstruct:"len=3"`
+		Data    uint32 `binstruct:"offsetfield=Offset,align,alignbytes=4"`
+	}
+	in := foo{
+		Name:    "binary",
+		Items:   []bar{{1, "a"}, {2, "bc"}},
+		Fixed:   [2]int16{-1, 1},
+		Padding: []byte{1},
+		Data:    0xDEADBEEF,
+	}
+	data, err := Marshal(in)
+	assert.NoError(t, err)
+
+	var out foo
+	assert.NoError(t, Unmarshal(data, &out))
+	in.Count = 2
+	in.Offset = 28
+	in.Padding = []byte{1, 0, 0}
+	assert.Equal(t, in, out)
+}
+
+func TestMarshalInvalidValue(t *testing.T) {
+	_, err := Marshal(nil)
+	assert.Equal(t, ErrInvalidMarshalValue, err)
+	var foo *struct{}
+	_, err = Marshal(foo)
+	assert.Equal(t, ErrInvalidMarshalValue, err)
+	_, err = Marshal(1)
+	assert.Equal(t, ErrInvalidMarshalValue, err)
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tooLong := struct {
+		A string `binstruct:"len=2"`
+	}{"abc"}
+	_, err := Marshal(tooLong)
+	assert.Equal(t, ErrLenExceeded, errors.Cause(err))
+
+	missingLen := struct {
+		A []byte
+	}{}
+	_, err = Marshal(missingLen)
+	assert.Equal(t, ErrLenRequired, errors.Cause(err))
+
+	mismatch := struct {
+		N uint8
+		A []byte `binstruct:"lenfield=N"`
+		B []byte `binstruct:"lenfield=N"`
+	}{0, []byte{1}, []byte{1, 2}}
+	_, err = Marshal(mismatch)
+	assert.Equal(t, ErrLenMismatch, errors.Cause(err))
+}
+
+func TestMarshalEndian(t *testing.T) {
+	type bar struct {
+		X uint16
+		Y uint16 `binstruct:"endian=little"`
+	}
+	foo := struct {
+		A    uint16
+		B    uint16 `binstruct:"endian=big"`
+		C    bar    `binstruct:"endian=big"`
+		Mark uint16
+		D    bar `binstruct:"endianfield=Mark"`
+	}{1, 2, bar{3, 4}, 0xFFFE, bar{5, 6}}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0, 0, 2, 0, 3, 4, 0, 0xFE, 0xFF, 0, 5, 6, 0}, data)
+}
+
+func TestMarshalMarshaler(t *testing.T) {
+	c := uvarint(127)
+	foo := struct {
+		N uint8
+		A reversedBytes `binstruct:"lenfield=N"`
+		B reversedBytes `binstruct:"len=3"`
+		C uvarint
+		D [2]uvarint
+		E *uvarint
+	}{0, reversedBytes{3, 2, 1}, reversedBytes{5, 4}, 300, [2]uvarint{1, 128}, &c}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3, 1, 2, 3, 4, 5, 0, 0xAC, 0x02, 0x01, 0x80, 0x01, 0x7F}, data)
+
+	tooLong := struct {
+		A reversedBytes `binstruct:"len=1"`
+	}{reversedBytes{1, 2}}
+	_, err = Marshal(tooLong)
+	assert.Equal(t, ErrLenExceeded, errors.Cause(err))
+}
+
+func TestMarshalUnmarshalerOnly(t *testing.T) {
+	foo := struct {
+		A summedPair
+		B []summedPair `binstruct:"len=2"`
+	}{summedPair{1, 2}, []summedPair{{3, 4}, {5, 6}}}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6}, data)
+
+	// the pair is still read using UnmarshalBinary
+	bar := struct {
+		A summedPair `binstruct:"len=2"`
+	}{}
+	assert.NoError(t, Unmarshal(data, &bar))
+	assert.Equal(t, summedPair{3, 0}, bar.A)
+}
@@ -0,0 +1,292 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// EncodingUTF8 reads and writes strings as UTF-8 without
+	// transcoding them.
+	EncodingUTF8 = "utf8"
+	// EncodingUTF16LE reads and writes strings as little-endian UTF-16.
+	EncodingUTF16LE = "utf16le"
+	// EncodingUTF16BE reads and writes strings as big-endian UTF-16.
+	EncodingUTF16BE = "utf16be"
+	// EncodingLatin1 reads and writes strings as ISO-8859-1.
+	EncodingLatin1 = "latin1"
+	// EncodingShiftJIS reads and writes strings as Shift_JIS, the JIS X
+	// 0208 character set with single byte ASCII and half-width katakana.
+	EncodingShiftJIS = "shiftjis"
+)
+
+var (
+	ErrOptionEncodingInvalid = errors.New("tag option encoding is not a registered encoding")
+	ErrUnencodableCharacter  = errors.New("string contains a character the encoding cannot represent")
+	ErrPartialCodeUnit       = errors.New("string bytes end part way through a code unit")
+)
+
+// TextEncoding transcodes strings between UTF-8 and the character
+// encoding used by the binary data.
+type TextEncoding interface {
+	// UnitSize returns the number of bytes in a code unit, which is
+	// the size of null terminators and of lengths counting code units.
+	UnitSize() int
+	// Decode converts bytes of the encoding to a UTF-8 string.
+	Decode(b []byte) (string, error)
+	// Encode converts a UTF-8 string to bytes of the encoding.
+	Encode(s string) ([]byte, error)
+}
+
+var encodings = struct {
+	sync.RWMutex
+	m map[string]TextEncoding
+}{m: map[string]TextEncoding{
+	EncodingUTF8:     utf8Encoding{},
+	EncodingUTF16LE:  utf16Encoding{binary.LittleEndian},
+	EncodingUTF16BE:  utf16Encoding{binary.BigEndian},
+	EncodingLatin1:   latin1Encoding{},
+	EncodingShiftJIS: shiftJISEncoding{},
+}}
+
+// RegisterEncoding registers a character encoding used by the encoding
+// tag option, such as an adapter for an encoding provided by
+// golang.org/x/text. Encodings must be registered
+// before the structs using them are first marshalled or unmarshalled.
+//
+// RegisterEncoding panics if the name is empty or already registered.
+func RegisterEncoding(name string, e TextEncoding) {
+	if name == "" || e == nil {
+		panic("binstruct: RegisterEncoding requires a name and an encoding")
+	}
+	encodings.Lock()
+	defer encodings.Unlock()
+	if _, ok := encodings.m[name]; ok {
+		panic(fmt.Sprintf("binstruct: encoding %s is already registered", name))
+	}
+	encodings.m[name] = e
+}
+
+// lookupEncoding returns the encoding registered to the name.
+func lookupEncoding(name string) (TextEncoding, bool) {
+	encodings.RLock()
+	defer encodings.RUnlock()
+	e, ok := encodings.m[name]
+	return e, ok
+}
+
+type utf8Encoding struct{}
+
+func (utf8Encoding) UnitSize() int {
+	return 1
+}
+
+func (utf8Encoding) Decode(b []byte) (string, error) {
+	return string(b), nil
+}
+
+func (utf8Encoding) Encode(s string) ([]byte, error) {
+	return []byte(s), nil
+}
+
+type utf16Encoding struct {
+	order binary.ByteOrder
+}
+
+func (utf16Encoding) UnitSize() int {
+	return 2
+}
+
+func (e utf16Encoding) Decode(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", ErrPartialCodeUnit
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = e.order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func (e utf16Encoding) Encode(s string) ([]byte, error) {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, len(units)*2)
+	for i, unit := range units {
+		e.order.PutUint16(b[i*2:], unit)
+	}
+	return b, nil
+}
+
+type latin1Encoding struct{}
+
+func (latin1Encoding) UnitSize() int {
+	return 1
+}
+
+func (latin1Encoding) Decode(b []byte) (string, error) {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes), nil
+}
+
+func (latin1Encoding) Encode(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			return nil, ErrUnencodableCharacter
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
+
+// shiftJISEncoding decodes characters which can't be represented as
+// utf8.RuneError.
+type shiftJISEncoding struct{}
+
+// jis0208Runes maps the code points of the JIS X 0208 characters to
+// their index in jis0208, and is built when first encoding.
+var jis0208Runes struct {
+	once sync.Once
+	m    map[rune]int
+}
+
+func (shiftJISEncoding) UnitSize() int {
+	return 1
+}
+
+func (shiftJISEncoding) Decode(b []byte) (string, error) {
+	runes := make([]rune, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			runes = append(runes, rune(c))
+		case c >= 0xA1 && c <= 0xDF:
+			// half-width katakana
+			runes = append(runes, rune(c)+0xFEC0)
+		case c >= 0x81 && c <= 0x9F || c >= 0xE0 && c <= 0xFC:
+			if i+1 == len(b) {
+				return "", ErrPartialCodeUnit
+			}
+			t := b[i+1]
+			if t < 0x40 || t == 0x7F || t > 0xFC {
+				// the invalid trail byte is read as a character
+				runes = append(runes, utf8.RuneError)
+				continue
+			}
+			i++
+			runes = append(runes, shiftJISRune(c, t))
+		default:
+			runes = append(runes, utf8.RuneError)
+		}
+	}
+	return string(runes), nil
+}
+
+func (shiftJISEncoding) Encode(s string) ([]byte, error) {
+	jis0208Runes.once.Do(func() {
+		jis0208Runes.m = make(map[rune]int, len(jis0208))
+		for i, r := range jis0208 {
+			if r != 0 {
+				jis0208Runes.m[rune(r)] = i
+			}
+		}
+	})
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			b = append(b, byte(r))
+		case r >= 0xFF61 && r <= 0xFF9F:
+			b = append(b, byte(r-0xFEC0))
+		case r == '¥':
+			// JIS X 0201 places the yen sign and overline where ASCII
+			// has the backslash and tilde
+			b = append(b, '\\')
+		case r == '‾':
+			b = append(b, '~')
+		default:
+			i, ok := jis0208Runes.m[r]
+			if !ok {
+				return nil, ErrUnencodableCharacter
+			}
+			row, cell := i/94, i%94
+			lead := byte(row/2 + 0x81)
+			if row >= 62 {
+				lead += 0x40
+			}
+			trail := byte(cell + 0x40)
+			if row%2 == 1 {
+				trail = byte(cell + 0x9F)
+			} else if cell >= 63 {
+				// 0x7F isn't used as a trail byte
+				trail++
+			}
+			b = append(b, lead, trail)
+		}
+	}
+	return b, nil
+}
+
+// shiftJISRune returns the JIS X 0208 character of the lead and trail
+// bytes, or utf8.RuneError when it's unassigned.
+func shiftJISRune(lead, trail byte) rune {
+	row := int(lead-0x81) * 2
+	if lead >= 0xE0 {
+		row = int(lead-0xC1) * 2
+	}
+	var cell int
+	switch {
+	case trail >= 0x9F:
+		row++
+		cell = int(trail - 0x9F)
+	case trail > 0x7F:
+		cell = int(trail - 0x41)
+	default:
+		cell = int(trail - 0x40)
+	}
+	if row >= 94 || jis0208[row*94+cell] == 0 {
+		return utf8.RuneError
+	}
+	return rune(jis0208[row*94+cell])
+}
+
+// stringSize converts a length of the string field, in either code
+// units or bytes as set by LenUnit, to its size in bytes.
+func (f *fieldDefinition) stringSize(n int64) int64 {
+	if f.Options.LenUnit == LenUnitBytes {
+		return n
+	}
+	return n * int64(f.Encoding.UnitSize())
+}
+
+// stringLen converts the size in bytes of the string field to its
+// length in either code units or bytes as set by LenUnit.
+func (f *fieldDefinition) stringLen(size int64) int64 {
+	if f.Options.LenUnit == LenUnitBytes {
+		return size
+	}
+	return size / int64(f.Encoding.UnitSize())
+}
+
+// trimPadding removes the trailing code units of the size consisting
+// of only the pad byte.
+func trimPadding(b []byte, pad byte, size int) []byte {
+	for len(b) >= size {
+		for _, c := range b[len(b)-size:] {
+			if c != pad {
+				return b
+			}
+		}
+		b = b[:len(b)-size]
+	}
+	return b
+}
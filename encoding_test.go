@@ -0,0 +1,130 @@
+package binstruct
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type encodedStrings struct {
+	A string `binstruct:"len=4,encoding=utf16le"`
+	B string `binstruct:"stringtype=null,encoding=utf16be"`
+	C string `binstruct:"stringtype=int8,encoding=utf16le"`
+	D string `binstruct:"stringtype=int8,encoding=utf16le,lenunit=bytes"`
+	E string `binstruct:"stringtype=null,encoding=latin1"`
+	N uint8
+	F string `binstruct:"lenfield=N,encoding=utf16le"`
+}
+
+var encodedStringsData = []byte{
+	'h', 0, 'i', 0, 0, 0, 0, 0,
+	0, 'A', 0x01, 0x00, 0, 0,
+	2, 0x3D, 0xD8, 0x00, 0xDE,
+	4, 'o', 0, 'k', 0,
+	'c', 'a', 'f', 0xE9, 0,
+	3, 'x', 0, 'y', 0, 'z', 0,
+}
+
+func TestUnmarshalEncoding(t *testing.T) {
+	var foo encodedStrings
+	assert.NoError(t, Unmarshal(encodedStringsData, &foo))
+	assert.Equal(t, encodedStrings{"hi", "AĀ", "\U0001F600", "ok", "café", 3, "xyz"}, foo)
+}
+
+func TestMarshalEncoding(t *testing.T) {
+	foo := encodedStrings{"hi", "AĀ", "\U0001F600", "ok", "café", 0, "xyz"}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, encodedStringsData, data)
+}
+
+func TestEncodingPadding(t *testing.T) {
+	// only whole code units of padding are removed
+	foo := struct {
+		A string `binstruct:"len=3,encoding=utf16le"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{0, 1, 0, 0, 0, 0}, &foo))
+	assert.Equal(t, "Ā", foo.A)
+}
+
+func TestEncodingErrors(t *testing.T) {
+	latin1 := struct {
+		A string `binstruct:"stringtype=null,encoding=latin1"`
+	}{"Ā"}
+	_, err := Marshal(latin1)
+	assert.Equal(t, ErrUnencodableCharacter, errors.Cause(err))
+
+	partial := struct {
+		A string `binstruct:"len=3,lenunit=bytes,encoding=utf16le"`
+	}{}
+	err = Unmarshal([]byte{'a', 0, 'b'}, &partial)
+	assert.Equal(t, ErrPartialCodeUnit, errors.Cause(err))
+
+	unknown := struct {
+		A string `binstruct:"len=1,encoding=ebcdic"`
+	}{}
+	_, err = Marshal(unknown)
+	assert.Equal(t, ErrOptionEncodingInvalid, errors.Cause(err))
+}
+
+func TestShiftJIS(t *testing.T) {
+	foo := struct {
+		A string `binstruct:"stringtype=null,encoding=shiftjis"`
+		B string `binstruct:"stringtype=int8,encoding=shiftjis"`
+	}{"日本語", "ｱｲ円"}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x93, 0xFA, 0x96, 0x7B, 0x8C, 0xEA, 0, 4, 0xB1, 0xB2, 0x89, 0x7E}, data)
+
+	foo.A, foo.B = "", ""
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, "日本語", foo.A)
+	assert.Equal(t, "ｱｲ円", foo.B)
+
+	// rows past 0x7F use the following trail byte, and characters which
+	// can't be represented are decoded as the replacement character
+	e := shiftJISEncoding{}
+	b, err := e.Encode("ア")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x83, 0x41}, b)
+	s, err := e.Decode([]byte{0x83, 0x80, 'a', 0x80, 0xF0, 0x40, 0x81, '!'})
+	assert.NoError(t, err)
+	assert.Equal(t, "ムa\uFFFD\uFFFD\uFFFD!", s)
+
+	_, err = e.Decode([]byte{'a', 0x93})
+	assert.Equal(t, ErrPartialCodeUnit, err)
+	_, err = e.Encode("\U0001F600")
+	assert.Equal(t, ErrUnencodableCharacter, err)
+}
+
+// upperEncoding stores strings in upper case.
+type upperEncoding struct{}
+
+func (upperEncoding) UnitSize() int {
+	return 1
+}
+
+func (upperEncoding) Decode(b []byte) (string, error) {
+	return strings.ToLower(string(b)), nil
+}
+
+func (upperEncoding) Encode(s string) ([]byte, error) {
+	return []byte(strings.ToUpper(s)), nil
+}
+
+func TestRegisterEncoding(t *testing.T) {
+	RegisterEncoding("upper", upperEncoding{})
+	foo := struct {
+		A string `binstruct:"stringtype=null,encoding=upper"`
+	}{"abc"}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ABC\x00"), data)
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, "abc", foo.A)
+
+	assert.Panics(t, func() { RegisterEncoding("upper", upperEncoding{}) })
+	assert.Panics(t, func() { RegisterEncoding("", upperEncoding{}) })
+}
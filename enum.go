@@ -0,0 +1,133 @@
+package binstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type EnumMode = string
+
+const (
+	// EnumLenient keeps values which aren't registered for the enum.
+	EnumLenient EnumMode = "lenient"
+	// EnumStrict fails on values which aren't registered for the enum.
+	EnumStrict EnumMode = "strict"
+)
+
+var (
+	ErrOptionEnumInvalid = errors.New("tag option enum must be strict or lenient")
+	ErrEnumUnregistered  = errors.New("tag option enum=strict requires the field's type to be registered by RegisterEnum")
+)
+
+// EnumError is returned in strict mode when a value isn't registered
+// for its enum type.
+type EnumError struct {
+	// Value is the unknown value, as the enum type.
+	Value interface{}
+}
+
+func (e *EnumError) Error() string {
+	return "unknown enum value " + EnumName(e.Value)
+}
+
+// enum holds the names of the values of an integer type.
+type enum struct {
+	Type  reflect.Type
+	names map[uint64]string
+}
+
+var enums = struct {
+	sync.RWMutex
+	m map[reflect.Type]*enum
+}{m: make(map[reflect.Type]*enum)}
+
+// RegisterEnum registers the values of an integer type and their names,
+// given as a map from each value to its name. Values of the type, and
+// the elements of slices and arrays of the type, are checked against
+// the registered values by fields using the strict enum mode.
+// Registering an enum clears the cache of struct definitions, so the
+// structs using it are parsed again.
+//
+//	binstruct.RegisterEnum(map[Opcode]string{
+//		OpcodeLoad:  "OpcodeLoad",
+//		OpcodeStore: "OpcodeStore",
+//	})
+//
+// RegisterEnum panics if the map's keys aren't integers or the type is
+// already registered.
+func RegisterEnum(names interface{}) {
+	m := reflect.ValueOf(names)
+	if m.Kind() != reflect.Map || !isInteger(m.Type().Key().Kind()) || m.Type().Elem().Kind() != reflect.String {
+		panic("binstruct: RegisterEnum requires a map from integer values to names")
+	}
+	e := &enum{Type: m.Type().Key(), names: make(map[uint64]string, m.Len())}
+	for _, key := range m.MapKeys() {
+		e.names[uint64(intValue(key))] = m.MapIndex(key).String()
+	}
+
+	enums.Lock()
+	if _, ok := enums.m[e.Type]; ok {
+		enums.Unlock()
+		panic(fmt.Sprintf("binstruct: enum %v is already registered", e.Type))
+	}
+	enums.m[e.Type] = e
+	enums.Unlock()
+	ClearCache()
+}
+
+// lookupEnum returns the enum registered for the type, or nil if the
+// type isn't an enum.
+func lookupEnum(t reflect.Type) *enum {
+	enums.RLock()
+	defer enums.RUnlock()
+	return enums.m[t]
+}
+
+// EnumName returns the name of the value followed by the value in hex,
+// such as OpcodeLoad(0x12). Values which aren't registered are named by
+// their type, such as Opcode(0x13), and values of other types are
+// formatted in decimal. EnumName may be used to implement fmt.Stringer.
+func EnumName(v interface{}) string {
+	value := reflect.ValueOf(v)
+	if !value.IsValid() || !isInteger(value.Kind()) {
+		return fmt.Sprint(v)
+	}
+	if e := lookupEnum(value.Type()); e != nil {
+		return e.name(value)
+	}
+	// formatting the value itself would call its String method
+	switch value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10)
+	}
+	return strconv.FormatInt(value.Int(), 10)
+}
+
+// name formats the value with its registered name.
+func (e *enum) name(v reflect.Value) string {
+	name, ok := e.names[uint64(intValue(v))]
+	if !ok {
+		name = e.Type.Name()
+	}
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("%s(%#x)", name, v.Uint())
+	}
+	return fmt.Sprintf("%s(%#x)", name, v.Int())
+}
+
+// checkEnum fails when the field is strict and the value isn't
+// registered for the field's enum.
+func (f *fieldDefinition) checkEnum(v reflect.Value) error {
+	if f.Enum == nil || f.Options.Enum != EnumStrict || v.Type() != f.Enum.Type {
+		return nil
+	}
+	if _, ok := f.Enum.names[uint64(intValue(v))]; !ok {
+		return &EnumError{Value: v.Interface()}
+	}
+	return nil
+}
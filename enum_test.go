@@ -0,0 +1,154 @@
+package binstruct
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type testOpcode uint8
+
+const (
+	testOpcodeLoad  testOpcode = 0x12
+	testOpcodeStore testOpcode = 0x13
+)
+
+func (o testOpcode) String() string {
+	return EnumName(o)
+}
+
+type testRecordType int16
+
+func init() {
+	RegisterEnum(map[testOpcode]string{
+		testOpcodeLoad:  "OpcodeLoad",
+		testOpcodeStore: "OpcodeStore",
+	})
+	RegisterEnum(map[testRecordType]string{
+		-1: "RecordEnd",
+	})
+}
+
+func TestEnumName(t *testing.T) {
+	assert.Equal(t, "OpcodeLoad(0x12)", EnumName(testOpcodeLoad))
+	assert.Equal(t, "testOpcode(0x14)", EnumName(testOpcode(0x14)))
+	assert.Equal(t, "OpcodeStore(0x13)", fmt.Sprint(testOpcodeStore))
+	assert.Equal(t, "RecordEnd(-0x1)", EnumName(testRecordType(-1)))
+	assert.Equal(t, "7", EnumName(uint8(7)))
+	assert.Equal(t, "-7", EnumName(-7))
+	assert.Equal(t, "foo", EnumName("foo"))
+}
+
+func TestUnmarshalEnumLenient(t *testing.T) {
+	program := struct {
+		Op   testOpcode
+		Ops  []testOpcode `binstruct:"len=2"`
+		Kind testRecordType
+	}{}
+	assert.NoError(t, Unmarshal([]byte{0x14, 0x12, 0x15, 0xFE, 0xFF}, &program))
+	assert.Equal(t, testOpcode(0x14), program.Op)
+	assert.Equal(t, []testOpcode{testOpcodeLoad, 0x15}, program.Ops)
+	assert.Equal(t, testRecordType(-2), program.Kind)
+}
+
+func TestUnmarshalEnumStrict(t *testing.T) {
+	program := struct {
+		Op   testOpcode     `binstruct:"enum=strict"`
+		Ops  []testOpcode   `binstruct:"len=2,enum=strict"`
+		Kind testRecordType `binstruct:"enum=strict"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{0x12, 0x12, 0x13, 0xFF, 0xFF}, &program))
+	assert.Equal(t, []testOpcode{testOpcodeLoad, testOpcodeStore}, program.Ops)
+	assert.Equal(t, testRecordType(-1), program.Kind)
+
+	err := Unmarshal([]byte{0x12, 0x12, 0x15, 0xFF, 0xFF}, &program)
+	if e, ok := errors.Cause(err).(*EnumError); assert.True(t, ok) {
+		assert.Equal(t, testOpcode(0x15), e.Value)
+	}
+	assert.EqualError(t, err, "failed to decode field Ops[1] at offset 3: unknown enum value testOpcode(0x15)")
+}
+
+func TestMarshalEnumStrict(t *testing.T) {
+	program := struct {
+		Op testOpcode `binstruct:"enum=strict"`
+	}{testOpcodeStore}
+	b, err := Marshal(&program)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x13}, b)
+
+	program.Op = 0x20
+	_, err = Marshal(&program)
+	assert.IsType(t, &EnumError{}, errors.Cause(err))
+}
+
+func TestEnumDefaultStrict(t *testing.T) {
+	defer SetDefaultOptions(defaultFieldOptions)
+	options := &FieldOptions{}
+	*options = *defaultFieldOptions
+	options.Enum = EnumStrict
+	SetDefaultOptions(options)
+
+	program := struct {
+		Op    testOpcode
+		Other uint8
+		Loose testOpcode `binstruct:"enum=lenient"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{0x12, 0xFF, 0xFF}, &program))
+	err := Unmarshal([]byte{0xFF, 0xFF, 0xFF}, &program)
+	assert.IsType(t, &EnumError{}, errors.Cause(err))
+}
+
+func TestUnknownVariantEnumName(t *testing.T) {
+	packet := struct {
+		Op      testOpcode
+		Payload testPayload `binstruct:"switch=Op"`
+	}{}
+	err := Unmarshal([]byte{0x12, 0}, &packet)
+	assert.Equal(t, ErrUnknownVariant, errors.Cause(err))
+	assert.Contains(t, err.Error(), "discriminator OpcodeLoad(0x12)")
+}
+
+func TestRegisterEnumPanics(t *testing.T) {
+	assert.Panics(t, func() { RegisterEnum(map[testOpcode]string{}) })
+	assert.Panics(t, func() { RegisterEnum(map[string]string{}) })
+	assert.Panics(t, func() { RegisterEnum([]string{"a"}) })
+	assert.Panics(t, func() { RegisterEnum(nil) })
+}
+
+func TestEnumInvalid(t *testing.T) {
+	_, err := Marshal(&struct {
+		Op testOpcode `binstruct:"enum=loose"`
+	}{})
+	assert.Equal(t, ErrOptionEnumInvalid, errors.Cause(err))
+}
+
+func TestEnumRegisteredLater(t *testing.T) {
+	type flags uint8
+	type header struct {
+		Flags flags `binstruct:"enum=strict"`
+	}
+	var h header
+	err := Unmarshal([]byte{0x01}, &h)
+	assert.Equal(t, ErrEnumUnregistered, errors.Cause(err))
+
+	// structs parsed before the enum is registered are parsed again
+	defer SetDefaultOptions(defaultFieldOptions)
+	options := &FieldOptions{}
+	*options = *defaultFieldOptions
+	options.Enum = EnumStrict
+	SetDefaultOptions(options)
+	type defaulted struct {
+		Flags flags
+	}
+	var d defaulted
+	assert.NoError(t, Unmarshal([]byte{0x02}, &d))
+
+	RegisterEnum(map[flags]string{1: "FlagA"})
+	assert.NoError(t, Unmarshal([]byte{0x01}, &h))
+	err = Unmarshal([]byte{0x02}, &h)
+	assert.IsType(t, &EnumError{}, errors.Cause(err))
+	err = Unmarshal([]byte{0x02}, &d)
+	assert.IsType(t, &EnumError{}, errors.Cause(err))
+}
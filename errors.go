@@ -0,0 +1,85 @@
+package binstruct
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FieldError describes a failure to decode or encode a field.
+type FieldError struct {
+	// Op is the operation which failed, either "decode" or "encode".
+	Op string
+	// Path is the path to the field from the top-level struct, such as
+	// Header.Sections[3].Name.
+	Path string
+	// Offset is the position in bytes where the failure occurred. When
+	// decoding the position is absolute to the start of the input, when
+	// encoding it's relative to the start of the value being encoded.
+	Offset int64
+	// Expected is the number of bytes required at the offset, or zero
+	// when the failure isn't caused by a lack of bytes.
+	Expected int64
+	// Available is the number of bytes which were available at the
+	// offset, or -1 when unknown.
+	Available int64
+	// Err is the underlying cause of the failure.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	message := fmt.Sprintf("failed to %s field %s at offset %d: %v", e.Op, e.Path, e.Offset, e.Err)
+	if e.Expected > 0 && e.Available >= 0 {
+		message += fmt.Sprintf(" (expected %d bytes, %d available)", e.Expected, e.Available)
+	}
+	return message
+}
+
+// Unwrap returns the underlying cause, for use with errors.Is and errors.As.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying cause, for use with errors.Cause.
+func (e *FieldError) Cause() error {
+	return e.Err
+}
+
+// eofError creates the error returned when fewer than n bytes are
+// available at the position.
+func eofError(pos int64, n int64, available int64) error {
+	if available < 0 {
+		available = 0
+	}
+	return &FieldError{
+		Offset:    pos,
+		Expected:  n,
+		Available: available,
+		Err:       io.ErrUnexpectedEOF,
+	}
+}
+
+// wrapFieldError prefixes the path of the error with the name of the
+// field or element index, errors which aren't a FieldError are
+// wrapped by one at the given offset.
+func wrapFieldError(err error, op string, name string, offset int64) error {
+	e, ok := err.(*FieldError)
+	if !ok {
+		e = &FieldError{Offset: offset, Available: -1, Err: err}
+	}
+	e.Op = op
+	switch {
+	case e.Path == "":
+		e.Path = name
+	case strings.HasPrefix(e.Path, "["):
+		e.Path = name + e.Path
+	default:
+		e.Path = name + "." + e.Path
+	}
+	return e
+}
+
+// indexName returns the path component of a slice or array element.
+func indexName(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
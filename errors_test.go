@@ -0,0 +1,95 @@
+package binstruct
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type errorSection struct {
+	Len  uint8
+	Name string `binstruct:"lenfield=Len"`
+}
+
+type errorFile struct {
+	Header struct {
+		Magic    uint16
+		Sections [2]errorSection
+	}
+}
+
+func TestFieldErrorDecode(t *testing.T) {
+	data := []byte{0x42, 0x42, 0x01, 'a', 0x04, 'b', 'c'}
+	var file errorFile
+	err := Unmarshal(data, &file)
+
+	var fieldError *FieldError
+	if assert.True(t, errors.As(err, &fieldError)) {
+		assert.Equal(t, "decode", fieldError.Op)
+		assert.Equal(t, "Header.Sections[1].Name", fieldError.Path)
+		assert.Equal(t, int64(5), fieldError.Offset)
+		assert.Equal(t, int64(4), fieldError.Expected)
+		assert.Equal(t, int64(2), fieldError.Available)
+	}
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	assert.EqualError(t, err, "failed to decode field Header.Sections[1].Name at offset 5: unexpected EOF (expected 4 bytes, 2 available)")
+}
+
+func TestFieldErrorDecoderOffset(t *testing.T) {
+	data := []byte{0x42, 0x42, 0x01, 'a', 0x01, 'b', 0x42, 0x42, 0x01, 'a', 0x04, 'b', 'c'}
+	dec := NewDecoder(bytes.NewReader(data))
+	var file errorFile
+	assert.NoError(t, dec.Decode(&file))
+	err := dec.Decode(&file)
+
+	var fieldError *FieldError
+	if assert.True(t, errors.As(err, &fieldError)) {
+		assert.Equal(t, "Header.Sections[1].Name", fieldError.Path)
+		assert.Equal(t, int64(11), fieldError.Offset)
+		assert.Equal(t, int64(4), fieldError.Expected)
+		assert.Equal(t, int64(2), fieldError.Available)
+	}
+}
+
+func TestFieldErrorCause(t *testing.T) {
+	foo := struct {
+		A []struct {
+			B string
+		} `binstruct:"len=1"`
+	}{}
+	err := Unmarshal([]byte{1}, &foo)
+
+	var fieldError *FieldError
+	if assert.True(t, errors.As(err, &fieldError)) {
+		assert.Equal(t, "A[0].B", fieldError.Path)
+		assert.Equal(t, int64(0), fieldError.Offset)
+		assert.Equal(t, int64(-1), fieldError.Available)
+	}
+	assert.True(t, errors.Is(err, ErrLenRequired))
+	assert.EqualError(t, err, "failed to decode field A[0].B at offset 0: "+ErrLenRequired.Error())
+}
+
+func TestFieldErrorEncode(t *testing.T) {
+	foo := struct {
+		A uint32
+		B []struct {
+			C string `binstruct:"len=2"`
+		} `binstruct:"len=2"`
+	}{}
+	foo.B = make([]struct {
+		C string `binstruct:"len=2"`
+	}, 2)
+	foo.B[1].C = "abc"
+	_, err := Marshal(foo)
+
+	var fieldError *FieldError
+	if assert.True(t, errors.As(err, &fieldError)) {
+		assert.Equal(t, "encode", fieldError.Op)
+		assert.Equal(t, "B[1].C", fieldError.Path)
+		assert.Equal(t, int64(6), fieldError.Offset)
+	}
+	assert.True(t, errors.Is(err, ErrLenExceeded))
+}
@@ -0,0 +1,192 @@
+package binstruct
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type FloatType = string
+
+const (
+	// Float16 is an IEEE 754 half-precision float.
+	Float16 FloatType = "float16"
+	// Float32 is an IEEE 754 single-precision float.
+	Float32 FloatType = "float32"
+	// Float64 is an IEEE 754 double-precision float.
+	Float64 FloatType = "float64"
+)
+
+var (
+	ErrOptionFloatInvalid = errors.New("tag option float must be float16, float32 or float64 used with float fields")
+	ErrOptionFixedInvalid = errors.New("tag option fixed must be a format such as 16.16 totalling 8, 16, 32 or 64 bits used with float fields")
+	ErrFixedOverflow      = errors.New("value overflows the fixed-point format")
+)
+
+// fixedPoint is a signed fixed-point format with the number of
+// integer and fraction bits, such as 16.16.
+type fixedPoint struct {
+	IntBits  int
+	FracBits int
+}
+
+// parseFixedPoint parses a fixed-point format of the integer and
+// fraction bits separated by a dot.
+func parseFixedPoint(format string) (*fixedPoint, error) {
+	parts := strings.SplitN(format, ".", 2)
+	if len(parts) == 1 {
+		parts = append(parts, "0")
+	}
+	intBits, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, ErrOptionFixedInvalid
+	}
+	fracBits, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, ErrOptionFixedInvalid
+	}
+	if intBits < 0 || fracBits < 0 {
+		return nil, ErrOptionFixedInvalid
+	}
+	switch intBits + fracBits {
+	case 8, 16, 32, 64:
+	default:
+		return nil, ErrOptionFixedInvalid
+	}
+	return &fixedPoint{IntBits: intBits, FracBits: fracBits}, nil
+}
+
+// Size returns the number of bytes used by the format.
+func (p *fixedPoint) Size() int {
+	return (p.IntBits + p.FracBits) / 8
+}
+
+// isFloat determines whether the kind is a float.
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// floatSize returns the number of bytes of the field's float type,
+// defaulting to the size of the kind.
+func floatSize(f *fieldDefinition, kind reflect.Kind) int {
+	switch f.Options.Float {
+	case Float16:
+		return 2
+	case Float32:
+		return 4
+	case Float64:
+		return 8
+	}
+	return kindSize(kind)
+}
+
+// readFloat reads a float of the field's float type or fixed-point
+// format.
+func (d *decoder) readFloat(f *fieldDefinition, kind reflect.Kind) (float64, error) {
+	if p := f.Fixed; p != nil {
+		value, err := d.readInt(p.Size())
+		if err != nil {
+			return 0, err
+		}
+		return math.Ldexp(float64(value), -p.FracBits), nil
+	}
+	size := floatSize(f, kind)
+	value, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 2:
+		return float64(float16frombits(uint16(value))), nil
+	case 4:
+		return float64(math.Float32frombits(uint32(value))), nil
+	}
+	return math.Float64frombits(value), nil
+}
+
+// writeFloat writes a float of the field's float type or fixed-point
+// format, fixed-point values are rounded to the nearest fraction with
+// ties rounded to even.
+func (e *encoder) writeFloat(f *fieldDefinition, kind reflect.Kind, value float64) error {
+	if p := f.Fixed; p != nil {
+		scaled := math.RoundToEven(math.Ldexp(value, p.FracBits))
+		limit := math.Ldexp(1, p.IntBits+p.FracBits-1)
+		if math.IsNaN(scaled) || scaled < -limit || scaled >= limit {
+			return ErrFixedOverflow
+		}
+		return e.writeUint(p.Size(), uint64(int64(scaled)))
+	}
+	switch size := floatSize(f, kind); size {
+	case 2:
+		return e.writeUint(size, uint64(float16bits(float32(value))))
+	case 4:
+		return e.writeUint(size, uint64(math.Float32bits(float32(value))))
+	}
+	return e.writeUint(8, math.Float64bits(value))
+}
+
+// float16frombits converts IEEE 754 half-precision bits to a float32.
+func float16frombits(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1F
+	frac := uint32(h) & 0x3FF
+	switch exp {
+	case 0:
+		// zero and subnormal values
+		value := float32(frac) / (1 << 24)
+		if sign != 0 {
+			value = -value
+		}
+		return value
+	case 0x1F:
+		// infinity and NaN
+		return math.Float32frombits(sign | 0x7F800000 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+}
+
+// float16bits converts a float32 to IEEE 754 half-precision bits,
+// rounding to the nearest even value. Values too large for the
+// format become infinity.
+func float16bits(value float32) uint16 {
+	b := math.Float32bits(value)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23) & 0xFF
+	frac := b & 0x7FFFFF
+	if exp == 0xFF {
+		// infinity and NaN, NaNs keep a non-zero fraction
+		if frac != 0 {
+			return sign | 0x7E00 | uint16(frac>>13)
+		}
+		return sign | 0x7C00
+	}
+	e := exp - 127 + 15
+	if e >= 0x1F {
+		return sign | 0x7C00
+	}
+	if e <= 0 {
+		// subnormal values include the implicit leading bit
+		if e < -10 {
+			return sign
+		}
+		m := frac | 0x800000
+		shift := uint(14 - e)
+		h := m >> shift
+		remainder := m & (1<<shift - 1)
+		half := uint32(1) << (shift - 1)
+		if remainder > half || remainder == half && h&1 == 1 {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	h := uint32(e)<<10 | frac>>13
+	remainder := frac & 0x1FFF
+	if remainder > 0x1000 || remainder == 0x1000 && h&1 == 1 {
+		// rounding may carry into the exponent, up to infinity
+		h++
+	}
+	return sign | uint16(h)
+}
@@ -0,0 +1,129 @@
+package binstruct
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloat16(t *testing.T) {
+	values := []struct {
+		bits  uint16
+		value float32
+	}{
+		{0x0000, 0},
+		{0x3C00, 1},
+		{0xC000, -2},
+		{0x3555, 0.333251953125},
+		{0x7BFF, 65504},
+		{0x0001, 1.0 / (1 << 24)},
+		{0x0400, 1.0 / (1 << 14)},
+		{0x7C00, float32(math.Inf(1))},
+		{0xFC00, float32(math.Inf(-1))},
+	}
+	for _, v := range values {
+		assert.Equal(t, v.value, float16frombits(v.bits))
+		assert.Equal(t, v.bits, float16bits(v.value))
+	}
+	assert.True(t, math.IsNaN(float64(float16frombits(0x7E00))))
+	assert.Equal(t, uint16(0x7E00), float16bits(float32(math.NaN()))&0x7E00)
+
+	// rounding to the nearest even value, overflowing to infinity
+	assert.Equal(t, uint16(0x3C00), float16bits(1+1.0/(1<<11)))
+	assert.Equal(t, uint16(0x3C02), float16bits(1+3.0/(1<<11)))
+	assert.Equal(t, uint16(0x7C00), float16bits(65520))
+	assert.Equal(t, uint16(0x0000), float16bits(1.0/(1<<25)))
+	assert.Equal(t, uint16(0x0001), float16bits(1.5/(1<<25)))
+}
+
+type floats struct {
+	A float32    `binstruct:"endian=big"`
+	B float32    `binstruct:"float=float16"`
+	C [2]float64 `binstruct:"float=float16,endian=big"`
+	D float64    `binstruct:"float=float32"`
+	E float64    `binstruct:"fixed=16.16"`
+	F float32    `binstruct:"fixed=8.8,endian=big"`
+	G float32    `binstruct:"fixed=2.14"`
+}
+
+var floatsData = []byte{
+	0x3F, 0xC0, 0x00, 0x00,
+	0x00, 0x3C,
+	0xC0, 0x00, 0x3E, 0x00,
+	0x00, 0x00, 0x20, 0x40,
+	0x00, 0x80, 0xFE, 0xFF,
+	0x02, 0x40,
+	0x00, 0x80,
+}
+
+func TestUnmarshalFloats(t *testing.T) {
+	var foo floats
+	assert.NoError(t, Unmarshal(floatsData, &foo))
+	assert.Equal(t, floats{1.5, 1, [2]float64{-2, 1.5}, 2.5, -1.5, 2.25, -2}, foo)
+}
+
+func TestMarshalFloats(t *testing.T) {
+	foo := floats{1.5, 1, [2]float64{-2, 1.5}, 2.5, -1.5, 2.25, -2}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, floatsData, data)
+
+	// fixed-point values are rounded to the nearest fraction
+	rounded := struct {
+		A float64 `binstruct:"fixed=8.8"`
+		B float64 `binstruct:"fixed=8.8"`
+	}{1.0 / 512, 3.0 / 512}
+	data, err = Marshal(rounded)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00, 0x02, 0x00}, data)
+}
+
+func TestFixedPointTrailingZeros(t *testing.T) {
+	// the fraction bits keep their trailing zeros
+	foo := struct {
+		A float64 `binstruct:"fixed=2.30"`
+		B float32 `binstruct:"fixed=22.10,endian=big"`
+	}{1.5, -1}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x60, 0xFF, 0xFF, 0xFC, 0x00}, data)
+
+	foo.A, foo.B = 0, 0
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, 1.5, foo.A)
+	assert.Equal(t, float32(-1), foo.B)
+}
+
+func TestFloatErrors(t *testing.T) {
+	overflow := struct {
+		A float64 `binstruct:"fixed=8.8"`
+	}{128}
+	_, err := Marshal(overflow)
+	assert.Equal(t, ErrFixedOverflow, errors.Cause(err))
+
+	integer := struct {
+		A int16 `binstruct:"fixed=8.8"`
+	}{}
+	_, err = Marshal(integer)
+	assert.Equal(t, ErrOptionFixedInvalid, errors.Cause(err))
+
+	size := struct {
+		A float32 `binstruct:"fixed=8.4"`
+	}{}
+	_, err = Marshal(size)
+	assert.Equal(t, ErrOptionFixedInvalid, errors.Cause(err))
+
+	unknown := struct {
+		A float32 `binstruct:"float=float8"`
+	}{}
+	_, err = Marshal(unknown)
+	assert.Equal(t, ErrOptionFloatInvalid, errors.Cause(err))
+
+	both := struct {
+		A float32 `binstruct:"float=float16,fixed=8.8"`
+	}{}
+	_, err = Marshal(both)
+	assert.Equal(t, ErrOptionFloatInvalid, errors.Cause(err))
+}
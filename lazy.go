@@ -0,0 +1,175 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrLazyEmpty   = errors.New("lazy value has neither been unmarshalled nor set")
+	ErrLazyElement = errors.New("lazy values can't be the elements of slices or arrays")
+)
+
+var lazyType = reflect.TypeOf(Lazy{})
+
+// Lazy is a field holding a struct which is decoded when first accessed
+// rather than when the struct holding the field is unmarshalled. The
+// size of the value is given by the len, lenfield or sizefield options,
+// and unmarshalling records the position and size of its bytes without
+// reading them.
+//
+// Values unmarshalled by Unmarshal and ReaderAtDecoder are decoded from
+// the same byte slice or io.ReaderAt when accessed, whereas Decoder
+// reads the bytes from the stream into memory. Marshalling writes the
+// value given to Set or decoded by Decode, or otherwise copies the
+// unmarshalled bytes.
+//
+// Copies of a Lazy share the decoded value.
+type Lazy struct {
+	state *lazyState
+}
+
+type lazyState struct {
+	mu sync.Mutex
+	// src holds the bytes at pos, positioned as they were when
+	// unmarshalled.
+	src   source
+	pos   int64
+	size  int64
+	base  int64
+	order binary.ByteOrder
+	// value is the value decoded or set.
+	value reflect.Value
+}
+
+// Set sets the value written when marshalling, which is also returned
+// by Decode. v must be a struct or a pointer to a struct.
+func (l *Lazy) Set(v interface{}) error {
+	value, _, err := marshalTarget(v)
+	if err != nil {
+		return err
+	}
+	copied := reflect.New(value.Type()).Elem()
+	copied.Set(value)
+	l.state = &lazyState{value: copied}
+	return nil
+}
+
+// Decode stores the value in the struct pointed to by v, decoding it
+// from the unmarshalled bytes on first access. Later calls with the
+// same type return the value already decoded.
+func (l *Lazy) Decode(v interface{}) error {
+	value, definition, err := unmarshalTarget(v)
+	if err != nil {
+		return err
+	}
+	if l.state == nil {
+		return ErrLazyEmpty
+	}
+	s := l.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value.IsValid() && s.value.Type() == value.Type() {
+		value.Set(s.value)
+		return nil
+	}
+	if s.src == nil {
+		return ErrLazyEmpty
+	}
+	d := newDecoder(s.src)
+	d.pos, d.end, d.base, d.order = s.pos, s.pos+s.size, s.base, s.order
+	if err := d.decode(definition, value); err != nil {
+		return err
+	}
+	s.value = reflect.New(value.Type()).Elem()
+	s.value.Set(value)
+	return nil
+}
+
+// Offset returns the position of the unmarshalled bytes.
+func (l *Lazy) Offset() int64 {
+	if l.state == nil {
+		return 0
+	}
+	return l.state.base + l.state.pos
+}
+
+// Size returns the number of unmarshalled bytes.
+func (l *Lazy) Size() int64 {
+	if l.state == nil {
+		return 0
+	}
+	return l.state.size
+}
+
+// decodeLazy records the position and size of the lazy value and skips
+// its bytes, which are read into memory when reading from a stream.
+func (d *decoder) decodeLazy(f *fieldDefinition, parent reflect.Value, v reflect.Value) error {
+	var n int64
+	if f.Options.SizeField != "" {
+		n = intValue(parent.FieldByName(f.Options.SizeField))
+	} else {
+		var err error
+		if n, err = fieldLen(f, parent); err != nil {
+			return err
+		}
+	}
+	if n < 0 {
+		return ErrNegativeLen
+	}
+	if d.end >= 0 && n > d.end-d.pos {
+		return d.sizeError(n)
+	}
+	state := &lazyState{src: d.src, pos: d.pos, size: n, base: d.base, order: d.order}
+	if _, ok := d.src.(*readerSource); ok {
+		b, err := d.read(n)
+		if err != nil {
+			return err
+		}
+		state.src = &windowSource{b: append([]byte(nil), b...), pos: state.pos}
+	} else {
+		d.pos += n
+	}
+	v.Set(reflect.ValueOf(Lazy{state: state}))
+	return nil
+}
+
+// encodeLazy writes the lazy value, or copies its unmarshalled bytes
+// when it hasn't been decoded. Fixed-length values are padded to
+// their length.
+func (e *encoder) encodeLazy(f *fieldDefinition, l Lazy) error {
+	start := e.pos
+	if s := l.state; s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.value.IsValid() {
+			definition, err := cachedStructType(s.value.Type())
+			if err != nil {
+				return err
+			}
+			if err := e.encodeStruct(definition, s.value); err != nil {
+				return err
+			}
+		} else {
+			b, err := s.src.readAt(s.pos, s.size)
+			if err != nil {
+				return err
+			}
+			if err := e.write(b); err != nil {
+				return err
+			}
+		}
+	}
+	if f.Options.LenField != "" || f.Options.Len == 0 {
+		return nil
+	}
+	if n := e.pos - start; n > f.Options.Len {
+		return ErrLenExceeded
+	} else if n < f.Options.Len {
+		return e.write(make([]byte, f.Options.Len-n))
+	}
+	return nil
+}
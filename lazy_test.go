@@ -0,0 +1,134 @@
+package binstruct
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type lazyEntry struct {
+	ID   uint8
+	Name string `binstruct:"len=3"`
+}
+
+type lazyArchive struct {
+	Size  uint8
+	Entry Lazy `binstruct:"sizefield=Size"`
+	Tail  uint8
+}
+
+var lazyArchiveBytes = []byte{4, 7, 'a', 'b', 'c', 0xFF}
+
+// countingReaderAt records the number of bytes read.
+type countingReaderAt struct {
+	r    *bytes.Reader
+	read int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += n
+	return n, err
+}
+
+func TestUnmarshalLazy(t *testing.T) {
+	var archive lazyArchive
+	assert.NoError(t, Unmarshal(lazyArchiveBytes, &archive))
+	assert.Equal(t, uint8(0xFF), archive.Tail)
+	assert.Equal(t, int64(1), archive.Entry.Offset())
+	assert.Equal(t, int64(4), archive.Entry.Size())
+
+	var entry lazyEntry
+	assert.NoError(t, archive.Entry.Decode(&entry))
+	assert.Equal(t, lazyEntry{7, "abc"}, entry)
+
+	// the decoded value is kept once accessed
+	entry = lazyEntry{}
+	assert.NoError(t, archive.Entry.Decode(&entry))
+	assert.Equal(t, lazyEntry{7, "abc"}, entry)
+}
+
+func TestReaderAtDecoderLazy(t *testing.T) {
+	r := &countingReaderAt{r: bytes.NewReader(lazyArchiveBytes)}
+	dec := NewReaderAtDecoder(r, int64(len(lazyArchiveBytes)))
+	var archive lazyArchive
+	assert.NoError(t, dec.Decode(&archive))
+	assert.Equal(t, 2, r.read)
+
+	var entry lazyEntry
+	assert.NoError(t, archive.Entry.Decode(&entry))
+	assert.Equal(t, lazyEntry{7, "abc"}, entry)
+	assert.Equal(t, 6, r.read)
+}
+
+func TestDecoderLazy(t *testing.T) {
+	data := append(append([]byte(nil), lazyArchiveBytes...), lazyArchiveBytes...)
+	dec := NewDecoder(bytes.NewReader(data))
+	var first, second lazyArchive
+	assert.NoError(t, dec.Decode(&first))
+	assert.NoError(t, dec.Decode(&second))
+
+	var entry lazyEntry
+	assert.NoError(t, second.Entry.Decode(&entry))
+	assert.Equal(t, lazyEntry{7, "abc"}, entry)
+	assert.Equal(t, int64(7), second.Entry.Offset())
+	assert.NoError(t, first.Entry.Decode(&entry))
+	assert.Equal(t, lazyEntry{7, "abc"}, entry)
+}
+
+func TestUnmarshalLazyBounded(t *testing.T) {
+	// the entry is decoded within its size
+	var archive lazyArchive
+	assert.NoError(t, Unmarshal([]byte{2, 7, 'a', 'b', 'c', 0xFF}, &archive))
+	var entry lazyEntry
+	err := archive.Entry.Decode(&entry)
+	assert.Equal(t, ErrSizeExceeded, errors.Cause(err))
+
+	var empty Lazy
+	assert.Equal(t, ErrLazyEmpty, empty.Decode(&entry))
+	assert.Equal(t, int64(0), empty.Size())
+}
+
+func TestMarshalLazy(t *testing.T) {
+	// bytes which haven't been decoded are copied
+	var archive lazyArchive
+	assert.NoError(t, Unmarshal(lazyArchiveBytes, &archive))
+	b, err := Marshal(&archive)
+	assert.NoError(t, err)
+	assert.Equal(t, lazyArchiveBytes, b)
+
+	assert.NoError(t, archive.Entry.Set(lazyEntry{9, "xy"}))
+	b, err = Marshal(&archive)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{4, 9, 'x', 'y', 0, 0xFF}, b)
+
+	var entry lazyEntry
+	assert.NoError(t, archive.Entry.Decode(&entry))
+	assert.Equal(t, lazyEntry{9, "xy"}, entry)
+	assert.Equal(t, ErrInvalidMarshalValue, archive.Entry.Set(7))
+
+	// an empty lazy value writes nothing, or the padding of its length
+	fixed := struct {
+		Entry Lazy `binstruct:"len=2"`
+	}{}
+	b, err = Marshal(&fixed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0}, b)
+	assert.NoError(t, fixed.Entry.Set(lazyEntry{}))
+	_, err = Marshal(&fixed)
+	assert.Equal(t, ErrLenExceeded, errors.Cause(err))
+}
+
+func TestLazyInvalid(t *testing.T) {
+	_, err := Marshal(&struct {
+		Entries []Lazy `binstruct:"len=2"`
+	}{})
+	assert.Equal(t, ErrLazyElement, errors.Cause(err))
+
+	err = Unmarshal([]byte{1}, &struct {
+		Entry Lazy
+	}{})
+	assert.Equal(t, ErrLenRequired, errors.Cause(err))
+}
@@ -1,7 +1,11 @@
 package binstruct
 
-import "github.com/pkg/errors"
-import "math/bits"
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
 
 type StringType = string
 
@@ -25,8 +29,38 @@ const (
 	// StringInt64 is a string with the length determined by a
 	// 8-byte prefix.
 	StringInt64 StringType = "int64"
+	// StringULEB128 is a string with the length determined by an
+	// unsigned LEB128 prefix.
+	StringULEB128 StringType = IntULEB128
+	// StringSLEB128 is a string with the length determined by a
+	// signed LEB128 prefix.
+	StringSLEB128 StringType = IntSLEB128
+	// StringVarint is a string with the length determined by a
+	// Protocol Buffers varint prefix.
+	StringVarint StringType = IntVarint
+	// StringZigZag is a string with the length determined by a
+	// Protocol Buffers zigzag-encoded varint prefix.
+	StringZigZag StringType = IntZigZag
+)
+
+// LenRest is the Len of a string, slice or Unmarshaler which uses all
+// of the remaining bytes, set with the tag option len=rest.
+const LenRest = -1
+
+type Endian = string
+
+const (
+	// EndianLittle reads and writes values in little-endian byte order.
+	EndianLittle Endian = "little"
+	// EndianBig reads and writes values in big-endian byte order.
+	EndianBig Endian = "big"
 )
 
+// ByteOrderMark is the value of an integer field used with the
+// EndianField option when the byte order is unchanged. Reading the
+// swapped mark 0xFFFE selects the opposite byte order.
+const ByteOrderMark = 0xFEFF
+
 // FieldOptions define the options used when reading and writing
 // the struct field.
 type FieldOptions struct {
@@ -39,44 +73,149 @@ type FieldOptions struct {
 	// OffsetField is the name of a sibling field which will be
 	// used as the offset.
 	OffsetField string
+	// Ptr is the integer type, uint8, uint16, uint32 or uint64, of the
+	// offsets of pointer fields and of slices and arrays of pointers.
+	// The pointees are read from the offsets once the rest of the value
+	// has been read, and are written following the rest of the value.
+	// Nil pointers have an offset of zero.
+	Ptr string
+	// Rel is the position Ptr offsets are relative to, either the start
+	// of the value being read or written, the start of the struct
+	// holding the pointer, or the position of the offset itself.
+	Rel Rel
 	// Len is the fixed size of the slice or string being read or
 	// written. In the case of a string this is used when StringType
 	// is fixed. If the actual length of the string is lower than the
 	// fixed length, the remaining bytes will be padded with a null
-	// character, which can be overriden by setting StringPad.
+	// character, which can be overriden by setting StringPad. When Len
+	// is LenRest the value uses the remaining bytes.
 	Len int64
 	// LenField is the name of a sibling field which will be used as
 	// the slice or string length.
 	LenField string
+	// LenPrefix is the integer type of a length written before the
+	// elements of a slice, used instead of Len or LenField.
+	LenPrefix LenPrefix
+	// LenUnit determines whether a slice length is the number of
+	// elements or the total size of the elements in bytes, and whether
+	// a string length is the number of code units or bytes.
+	LenUnit LenUnit
+	// Until is the sentinel element terminating a slice, an integer for
+	// slices of integers or a condition such as Type==0xFF for slices of
+	// structs. The sentinel is written after the elements, and reading
+	// also ends when no bytes remain.
+	Until string
+	// SizeField is the name of a sibling field holding the size in
+	// bytes of a nested struct. The struct is read within that many
+	// bytes, skipping any unknown trailing bytes.
+	SizeField string
 	// StringType is the type of string to be read or written.
 	StringType StringType
 	// StringPad is the byte used for the remainder of fixed-length strings.
 	StringPad byte
+	// Encoding is the name of the character encoding of strings, which
+	// are transcoded to and from UTF-8, see RegisterEncoding.
+	Encoding string
 	// Align determines whether the struct data is aligned.
 	Align bool
 	// AlignBytes is the number of bytes to align the struct data to.
 	AlignBytes int64
 	// Mask is applied to integer values when reading (XOR) and writing (OR).
 	Mask uint64
+	// IntType is the encoding of integer values, either fixed-size or
+	// one of the variable-length encodings.
+	IntType IntType
+	// Float is the format of float values, either Float16, Float32 or
+	// Float64. When empty the size of the field's type is used.
+	Float FloatType
+	// Fixed is the signed fixed-point format of float values, the
+	// number of integer and fraction bits such as 16.16 or 8.8.
+	Fixed string
+	// Endian is the byte order of the value, which is inherited by the
+	// fields of nested structs. When empty the byte order of the parent
+	// is used, the Endian of the default options determines the byte
+	// order of the top-level struct (defaulting to little-endian).
+	Endian Endian
+	// EndianField is the name of a sibling field which selects the byte
+	// order of the value at runtime. A boolean field selects big-endian
+	// when true, an integer field is compared to ByteOrderMark.
+	EndianField string
+	// Bits is the number of bits used by a boolean or integer bitfield.
+	// Consecutive bitfields are packed into a storage unit the size of
+	// the first field's type, the positioning options of the first field
+	// apply to the whole unit.
+	Bits int64
+	// BitOrder determines whether bitfields are packed from the most
+	// or least significant bit of the storage unit.
+	BitOrder BitOrder
+	// Checksum is the name of the checksum algorithm computing the
+	// integer value over the fields given by Over, see RegisterChecksum.
+	// The checksum is filled in when marshalling and verified when
+	// unmarshalling.
+	Checksum string
+	// Over is the sibling field, or range of sibling fields such as
+	// Header..Payload, whose bytes are covered by the Checksum.
+	Over string
+	// Const is the value the field always holds, written by Marshal
+	// and verified by Unmarshal, also set by the magic option. It's an
+	// integer for integer fields, and text or a hex byte literal such
+	// as 0x89504E47 for byte arrays and fixed-length strings.
+	Const string
+	// Enum determines whether values of enum types which aren't
+	// registered fail or are kept, see RegisterEnum.
+	Enum EnumMode
+	// Switch is the name of a sibling field whose value selects the
+	// variant stored in an interface field, see RegisterVariant.
+	Switch string
+	// If is a condition which must be met by a sibling field for the
+	// field to be read or written, such as Flags&0x4 or Version>=3.
+	// The operators &, ==, !=, >=, <=, > and < are supported, and a
+	// condition of only the sibling's name is met when it's non-zero.
+	If string
 }
 
 var defaultFieldOptions = &FieldOptions{
 	Skip:        0,
 	Offset:      0,
 	OffsetField: "",
+	Ptr:         "",
+	Rel:         RelFile,
 	Len:         0,
 	LenField:    "",
+	LenPrefix:   "",
+	LenUnit:     LenUnitCount,
+	Until:       "",
+	SizeField:   "",
 	StringType:  StringFixed,
 	StringPad:   0,
+	Encoding:    EncodingUTF8,
 	Align:       false,
 	AlignBytes:  8,
 	Mask:        0,
+	IntType:     IntFixed,
+	Float:       "",
+	Fixed:       "",
+	Endian:      "",
+	EndianField: "",
+	Bits:        0,
+	BitOrder:    BitOrderMSB,
+	Checksum:    "",
+	Over:        "",
+	Const:       "",
+	Enum:        EnumLenient,
+	Switch:      "",
+	If:          "",
 }
 
 // SetDefaultOptions sets the default options for fields, these are overriden
-// by the tags defined alongside the struct field.
+// by the tags defined alongside the struct field. The cached struct
+// definitions are cleared so the new defaults take effect.
+//
+// SetDefaultOptions must not be called concurrently with marshalling
+// or unmarshalling.
 func SetDefaultOptions(options *FieldOptions) {
 	defaultFieldOptions = options
+	ClearCache()
 }
 
 // parseTagFieldOptions creates field options from the given tag.
@@ -84,6 +223,9 @@ func parseTagFieldOptions(t tag) (*FieldOptions, error) {
 	// make a shallow-copy of the default options
 	options := &FieldOptions{}
 	*options = *defaultFieldOptions
+	// the default byte order applies to the top-level struct and is
+	// inherited from there, so fields only use an explicit byte order
+	options.Endian = ""
 	if t != nil {
 		var err error
 		if t.Contains("skip") {
@@ -101,8 +243,20 @@ func parseTagFieldOptions(t tag) (*FieldOptions, error) {
 				return nil, errors.Wrap(err, "failed to parse offsetfield value")
 			}
 		}
+		if t.Contains("ptr") {
+			if options.Ptr, err = t.String("ptr"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse ptr value")
+			}
+		}
+		if t.Contains("rel") {
+			if options.Rel, err = t.String("rel"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse rel value")
+			}
+		}
 		if t.Contains("len") {
-			if options.Len, err = t.Int64("len"); err != nil {
+			if value, err := t.String("len"); err == nil && value == "rest" {
+				options.Len = LenRest
+			} else if options.Len, err = t.Int64("len"); err != nil {
 				return nil, errors.Wrap(err, "failed to parse len value")
 			}
 		}
@@ -111,6 +265,27 @@ func parseTagFieldOptions(t tag) (*FieldOptions, error) {
 				return nil, errors.Wrap(err, "failed to parse lenfield value")
 			}
 		}
+		if t.Contains("lenprefix") {
+			if options.LenPrefix, err = t.String("lenprefix"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse lenprefix value")
+			}
+		}
+		if t.Contains("lenunit") {
+			if options.LenUnit, err = t.String("lenunit"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse lenunit value")
+			}
+		}
+		if t.Contains("until") {
+			// integer sentinels are parsed by parseSentinel
+			if options.Until, err = t.Literal("until"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse until value")
+			}
+		}
+		if t.Contains("sizefield") {
+			if options.SizeField, err = t.String("sizefield"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse sizefield value")
+			}
+		}
 		if t.Contains("stringtype") {
 			if options.StringType, err = t.String("stringtype"); err != nil {
 				return nil, errors.Wrap(err, "failed to parse stringtype value")
@@ -121,6 +296,11 @@ func parseTagFieldOptions(t tag) (*FieldOptions, error) {
 				return nil, errors.Wrap(err, "failed to parse stringpad value")
 			}
 		}
+		if t.Contains("encoding") {
+			if options.Encoding, err = t.String("encoding"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse encoding value")
+			}
+		}
 		if t.Contains("align") {
 			if options.Align, err = t.Bool("align"); err != nil {
 				return nil, errors.Wrap(err, "failed to parse align value")
@@ -132,10 +312,81 @@ func parseTagFieldOptions(t tag) (*FieldOptions, error) {
 			}
 		}
 		if t.Contains("mask") {
-			if mask, err := t.Int64("mask"); err != nil {
-				options.Mask = uint64(mask)
+			mask, err := t.Int64("mask")
+			if err != nil {
 				return nil, errors.Wrap(err, "failed to parse mask value")
 			}
+			options.Mask = uint64(mask)
+		}
+		if t.Contains("int") {
+			if options.IntType, err = t.String("int"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse int value")
+			}
+		}
+		if t.Contains("float") {
+			if options.Float, err = t.String("float"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse float value")
+			}
+		}
+		if t.Contains("fixed") {
+			if options.Fixed, err = t.String("fixed"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse fixed value")
+			}
+		}
+		if t.Contains("endian") {
+			if options.Endian, err = t.String("endian"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse endian value")
+			}
+		}
+		if t.Contains("endianfield") {
+			if options.EndianField, err = t.String("endianfield"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse endianfield value")
+			}
+		}
+		if t.Contains("bits") {
+			if options.Bits, err = t.Int64("bits"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse bits value")
+			}
+		}
+		if t.Contains("bitorder") {
+			if options.BitOrder, err = t.String("bitorder"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse bitorder value")
+			}
+		}
+		if t.Contains("checksum") {
+			if options.Checksum, err = t.String("checksum"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse checksum value")
+			}
+		}
+		if t.Contains("over") {
+			if options.Over, err = t.String("over"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse over value")
+			}
+		}
+		if t.Contains("const") {
+			if options.Const, err = t.Literal("const"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse const value")
+			}
+		}
+		if t.Contains("magic") {
+			if options.Const, err = t.Literal("magic"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse magic value")
+			}
+		}
+		if t.Contains("enum") {
+			if options.Enum, err = t.String("enum"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse enum value")
+			}
+		}
+		if t.Contains("switch") {
+			if options.Switch, err = t.String("switch"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse switch value")
+			}
+		}
+		if t.Contains("if") {
+			if options.If, err = t.String("if"); err != nil {
+				return nil, errors.Wrap(err, "failed to parse if value")
+			}
 		}
 	}
 	return options, nil
@@ -145,3 +396,31 @@ func parseTagFieldOptions(t tag) (*FieldOptions, error) {
 func (o *FieldOptions) MaskBits() int {
 	return bits.Len64(o.Mask)
 }
+
+// stringPrefixSize returns the number of bytes used by the length prefix
+// of the string type, or zero if the string type has no prefix.
+func stringPrefixSize(t StringType) int {
+	switch t {
+	case StringInt8:
+		return 1
+	case StringInt16:
+		return 2
+	case StringInt32:
+		return 4
+	case StringInt64:
+		return 8
+	}
+	return 0
+}
+
+// byteOrder returns the byte order for the endian option, or nil
+// when the option isn't a known byte order.
+func byteOrder(e Endian) binary.ByteOrder {
+	switch e {
+	case EndianLittle, "":
+		return binary.LittleEndian
+	case EndianBig:
+		return binary.BigEndian
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 )
 
 func TestSetDefaultOptions(t *testing.T) {
+	defer SetDefaultOptions(defaultFieldOptions)
 	options := &FieldOptions{}
 	*options = *defaultFieldOptions
 	options.Align = true
@@ -21,7 +22,7 @@ func TestParseTagFieldOptions(t *testing.T) {
 	assert.Equal(t, defaultFieldOptions, options)
 	assert.NoError(t, err)
 
-	var fullTag reflect.StructTag = `binstruct:"skip=-1,offset=1,offsetfield=foo,len=2,lenfield=bar,stringtype=null,stringpad=b,align,alignbytes=8,mask=0xFFFFFFFF"`
+	var fullTag reflect.StructTag = `binstruct:"skip=-1,offset=1,offsetfield=foo,ptr=uint32,rel=self,len=2,lenfield=bar,lenprefix=varint,lenunit=bytes,until=0xFF,sizefield=corge,stringtype=null,stringpad=b,encoding=utf16le,align,alignbytes=8,mask=0xFFFFFFFF,int=zigzag,float=float16,fixed=16.16,endian=big,endianfield=baz,bits=3,bitorder=lsb,checksum=crc32,over=grault..garply,const=0x0102,enum=strict,switch=qux,if=quux&1"`
 	tag := parseTag(fullTag)
 	options, err = parseTagFieldOptions(tag)
 	assert.NoError(t, err)
@@ -29,16 +30,48 @@ func TestParseTagFieldOptions(t *testing.T) {
 		Skip:        -1,
 		Offset:      int64(1),
 		OffsetField: "foo",
+		Ptr:         LenPrefixUint32,
+		Rel:         RelSelf,
 		Len:         int64(2),
 		LenField:    "bar",
+		LenPrefix:   LenPrefixVarint,
+		LenUnit:     LenUnitBytes,
+		Until:       "0xFF",
+		SizeField:   "corge",
 		StringType:  StringNullTerminated,
 		StringPad:   byte('b'),
+		Encoding:    EncodingUTF16LE,
 		Align:       true,
 		AlignBytes:  8,
 		Mask:        0xFFFFFFFF,
+		IntType:     IntZigZag,
+		Float:       Float16,
+		Fixed:       "16.16",
+		Endian:      EndianBig,
+		EndianField: "baz",
+		Bits:        3,
+		BitOrder:    BitOrderLSB,
+		Checksum:    ChecksumCRC32,
+		Over:        "grault..garply",
+		Const:       "0x0102",
+		Enum:        EnumStrict,
+		Switch:      "qux",
+		If:          "quux&1",
 	}, options)
 }
 
+func TestParseTagFieldOptionsIgnoresDefaultEndian(t *testing.T) {
+	defer SetDefaultOptions(defaultFieldOptions)
+	options := &FieldOptions{}
+	*options = *defaultFieldOptions
+	options.Endian = EndianBig
+	SetDefaultOptions(options)
+
+	parsed, err := parseTagFieldOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", parsed.Endian)
+}
+
 func TestParseTagFieldInvalidSkip(t *testing.T) {
 	tag := parseTag(reflect.StructTag(`binstruct:"skip=A"`))
 	_, err := parseTagFieldOptions(tag)
@@ -98,3 +131,143 @@ func TestParseTagFieldInvalidMask(t *testing.T) {
 	_, err := parseTagFieldOptions(tag)
 	assert.EqualError(t, errors.Cause(err), ErrInvalidTagInt64.Error())
 }
+
+func TestParseTagFieldLenRest(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"len=rest"`))
+	options, err := parseTagFieldOptions(tag)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(LenRest), options.Len)
+}
+
+func TestParseTagFieldInvalidLenPrefix(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"lenprefix"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidLenUnit(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"lenunit"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidUntil(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"until"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagLiteral.Error())
+}
+
+func TestParseTagFieldInvalidSizeField(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"sizefield"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidEncoding(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"encoding"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidFloat(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"float"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidFixed(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"fixed"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldFixedLiteral(t *testing.T) {
+	for _, fixed := range []string{"2.30", "22.10", "32"} {
+		tag := parseTag(reflect.StructTag(`binstruct:"fixed=` + fixed + `"`))
+		options, err := parseTagFieldOptions(tag)
+		assert.NoError(t, err)
+		assert.Equal(t, fixed, options.Fixed)
+	}
+}
+
+func TestParseTagFieldInvalidInt(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"int"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidEndian(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"endian"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidEndianField(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"endianfield"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidBits(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"bits=A"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagInt64.Error())
+}
+
+func TestParseTagFieldInvalidBitOrder(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"bitorder"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidChecksum(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"checksum"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidOver(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"over"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidConst(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"const=1.5"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagLiteral.Error())
+
+	tag = parseTag(reflect.StructTag(`binstruct:"magic"`))
+	_, err = parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagLiteral.Error())
+}
+
+func TestParseTagFieldInvalidEnum(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"enum"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidPtr(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"ptr=4"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidRel(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"rel"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidSwitch(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"switch"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
+
+func TestParseTagFieldInvalidIf(t *testing.T) {
+	tag := parseTag(reflect.StructTag(`binstruct:"if"`))
+	_, err := parseTagFieldOptions(tag)
+	assert.EqualError(t, errors.Cause(err), ErrInvalidTagString.Error())
+}
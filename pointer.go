@@ -0,0 +1,272 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type Rel = string
+
+const (
+	// RelFile is an offset from the start of the value being read or
+	// written.
+	RelFile Rel = "file"
+	// RelParent is an offset from the start of the struct holding the
+	// pointer.
+	RelParent Rel = "parent"
+	// RelSelf is an offset from the position of the offset itself.
+	RelSelf Rel = "self"
+)
+
+var (
+	ErrOptionPtrInvalid = errors.New("tag option ptr must be uint8, uint16, uint32 or uint64 used with pointers, or slices and arrays of pointers")
+	ErrOptionRelInvalid = errors.New("tag option rel must be file, parent or self")
+	ErrPointerOverflow  = errors.New("pointer offset overflows the offset field")
+)
+
+// pointer is a pointer whose offset has been read or written, but
+// whose pointee is yet to be.
+type pointer struct {
+	f *fieldDefinition
+	// v is the pointer value.
+	v reflect.Value
+	// pos is the position of the offset, and base the position the
+	// offset is relative to.
+	pos  int64
+	base int64
+	// target is the position of the pointee when reading.
+	target int64
+	order  binary.ByteOrder
+}
+
+// pointerKey identifies the pointees read by their offset, or written
+// by their address, so pointers sharing an offset share the pointee.
+type pointerKey struct {
+	t    reflect.Type
+	addr uintptr
+}
+
+// pointerBase returns the position the field's offsets are relative to.
+func pointerBase(f *fieldDefinition, start int64, pos int64) int64 {
+	switch f.Options.Rel {
+	case RelParent:
+		return start
+	case RelSelf:
+		return pos
+	}
+	return 0
+}
+
+// decodePointers reads the offsets of the pointer, or the pointers of
+// the slice or array, deferring their pointees.
+func (d *decoder) decodePointers(f *fieldDefinition, parent reflect.Value, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		return d.decodePointer(f, v)
+	case reflect.Slice:
+		n, err := d.sliceLen(f, parent)
+		if err != nil {
+			return err
+		}
+		slice := d.makeSlice(v.Type(), n)
+		for i := 0; int64(i) < n; i++ {
+			slice = d.appendElement(slice)
+			if err := d.decodePointer(f, slice.Index(i)); err != nil {
+				return d.fieldError(err, indexName(i))
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := d.decodePointer(f, v.Index(i)); err != nil {
+			return d.fieldError(err, indexName(i))
+		}
+	}
+	return nil
+}
+
+// decodePointer reads the offset of the pointer, zero offsets are nil
+// pointers.
+func (d *decoder) decodePointer(f *fieldDefinition, v reflect.Value) error {
+	p := &pointer{f: f, v: v, pos: d.pos, base: pointerBase(f, d.start, d.pos), order: d.order}
+	offset, err := d.readUint(lenPrefixSize(f.Options.Ptr))
+	if err != nil {
+		return err
+	}
+	if offset == 0 {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	p.target = p.base + int64(offset)
+	d.pointers = append(d.pointers, p)
+	return nil
+}
+
+// resolvePointers reads the pointees of the pointers, which may have
+// pointers of their own. The pointee at the lowest position is read
+// first, so streams are read forwards when the pointees follow the
+// value. Pointers of the same type and offset share the pointee.
+func (d *decoder) resolvePointers() error {
+	// pointees aren't bounded by the structs holding their pointers
+	d.end = -1
+	read := make(map[pointerKey]reflect.Value)
+	for len(d.pointers) > 0 {
+		next := 0
+		for i, p := range d.pointers {
+			if p.target < d.pointers[next].target {
+				next = i
+			}
+		}
+		p := d.pointers[next]
+		d.pointers = append(d.pointers[:next], d.pointers[next+1:]...)
+
+		key := pointerKey{p.v.Type(), uintptr(p.target)}
+		if pointee, ok := read[key]; ok {
+			p.v.Set(pointee)
+			continue
+		}
+		d.pos, d.order = p.target, p.order
+		pointee := reflect.New(p.v.Type().Elem())
+		if err := d.decodeElement(p.f, pointee.Elem()); err != nil {
+			return d.fieldError(err, p.f.Field.Name)
+		}
+		p.v.Set(pointee)
+		read[key] = pointee
+	}
+	return nil
+}
+
+// relocatePointers moves the deferred pointers within the elements of
+// the slice to the same elements of the grown slice, which has copied
+// them to a new array.
+func (d *decoder) relocatePointers(slice reflect.Value, grown reflect.Value) {
+	size := slice.Type().Elem().Size()
+	if slice.Len() == 0 || size == 0 {
+		return
+	}
+	start := slice.Index(0).UnsafeAddr()
+	end := start + uintptr(slice.Len())*size
+	for _, p := range d.pointers {
+		addr := p.v.UnsafeAddr()
+		if addr < start || addr >= end {
+			continue
+		}
+		i := int((addr - start) / size)
+		if v, ok := relocateValue(slice.Index(i), grown.Index(i), p.v); ok {
+			p.v = v
+		}
+	}
+}
+
+// relocateValue returns the value within to found at the same place
+// as v is within from, where from and to have the same type.
+func relocateValue(from reflect.Value, to reflect.Value, v reflect.Value) (reflect.Value, bool) {
+	if from.UnsafeAddr() == v.UnsafeAddr() && from.Type() == v.Type() {
+		return to, true
+	}
+	switch from.Kind() {
+	case reflect.Struct:
+		for i := 0; i < from.NumField(); i++ {
+			if r, ok := relocateValue(from.Field(i), to.Field(i), v); ok {
+				return r, true
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < from.Len(); i++ {
+			if r, ok := relocateValue(from.Index(i), to.Index(i), v); ok {
+				return r, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// encodePointers writes placeholder offsets for the pointer, or the
+// pointers of the slice or array, deferring their pointees.
+func (e *encoder) encodePointers(f *fieldDefinition, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		return e.encodePointer(f, v)
+	}
+	options := f.Options
+	n := int64(v.Len())
+	fixed := false
+	if v.Kind() == reflect.Slice {
+		if options.LenPrefix == "" && options.LenField == "" && options.Len == 0 {
+			return ErrLenRequired
+		}
+		fixed = options.LenPrefix == "" && options.LenField == ""
+		if fixed && n > options.Len {
+			return ErrLenExceeded
+		}
+		if options.LenPrefix != "" {
+			if err := e.writeLenPrefix(options.LenPrefix, n); err != nil {
+				return err
+			}
+		}
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encodePointer(f, v.Index(i)); err != nil {
+			return e.fieldError(err, indexName(i))
+		}
+	}
+	if !fixed {
+		return nil
+	}
+	// pad fixed-length slices with nil pointers
+	zero := reflect.Zero(v.Type().Elem())
+	for i := n; i < options.Len; i++ {
+		if err := e.encodePointer(f, zero); err != nil {
+			return e.fieldError(err, indexName(int(i)))
+		}
+	}
+	return nil
+}
+
+// encodePointer writes a zero offset, which is fixed up once the
+// pointee has been written.
+func (e *encoder) encodePointer(f *fieldDefinition, v reflect.Value) error {
+	p := &pointer{f: f, v: v, pos: e.pos, base: pointerBase(f, e.start, e.pos), order: e.order}
+	if err := e.writeUint(lenPrefixSize(f.Options.Ptr), 0); err != nil {
+		return err
+	}
+	if !v.IsNil() {
+		e.pointers = append(e.pointers, p)
+	}
+	return nil
+}
+
+// layoutPointers writes the pointees following the bytes written, in
+// the order their pointers were written, and fixes up the offsets.
+// Pointees may have pointers of their own, which are written after.
+func (e *encoder) layoutPointers() error {
+	written := make(map[pointerKey]int64)
+	for len(e.pointers) > 0 {
+		p := e.pointers[0]
+		e.pointers = e.pointers[1:]
+
+		key := pointerKey{p.v.Type(), p.v.Pointer()}
+		target, ok := written[key]
+		if !ok {
+			target = e.end
+			e.pos, e.order = target, p.order
+			if err := e.encodeElement(p.f, p.v.Elem()); err != nil {
+				return e.fieldError(err, p.f.Field.Name)
+			}
+			written[key] = target
+		}
+		offset := target - p.base
+		size := lenPrefixSize(p.f.Options.Ptr)
+		if offset <= 0 || size < 8 && uint64(offset) >= 1<<uint(size*8) {
+			return e.fieldError(ErrPointerOverflow, p.f.Field.Name)
+		}
+		e.pos, e.order = p.pos, p.order
+		if err := e.writeUint(size, uint64(offset)); err != nil {
+			return e.fieldError(err, p.f.Field.Name)
+		}
+	}
+	e.pos = e.end
+	return nil
+}
@@ -0,0 +1,214 @@
+package binstruct
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSection struct {
+	Type uint8
+	Size uint16
+}
+
+type testSectionTable struct {
+	Count    uint8
+	Sections []*testSection `binstruct:"ptr=uint16,lenfield=Count"`
+	Name     *testSection   `binstruct:"ptr=uint16"`
+	Tail     uint8
+}
+
+var testSectionTableBytes = []byte{
+	3,
+	10, 0, 0, 0, 13, 0,
+	10, 0,
+	0xFF,
+	// the pointees follow in the order of their pointers, the shared
+	// pointee is written once
+	1, 2, 0,
+	3, 4, 0,
+}
+
+func TestMarshalPointers(t *testing.T) {
+	shared := &testSection{1, 2}
+	table := testSectionTable{
+		Sections: []*testSection{shared, nil, {3, 4}},
+		Name:     shared,
+		Tail:     0xFF,
+	}
+	b, err := Marshal(&table)
+	assert.NoError(t, err)
+	assert.Equal(t, testSectionTableBytes, b)
+
+	var buf bytes.Buffer
+	assert.NoError(t, NewEncoder(&buf).Encode(&table))
+	assert.NoError(t, NewEncoder(&buf).Encode(&table))
+	assert.Equal(t, append(testSectionTableBytes, testSectionTableBytes...), buf.Bytes())
+}
+
+func TestUnmarshalPointers(t *testing.T) {
+	var table testSectionTable
+	assert.NoError(t, Unmarshal(testSectionTableBytes, &table))
+	assert.Equal(t, uint8(3), table.Count)
+	assert.Equal(t, []*testSection{{1, 2}, nil, {3, 4}}, table.Sections)
+	assert.Equal(t, &testSection{1, 2}, table.Name)
+	assert.True(t, table.Name == table.Sections[0])
+	assert.Equal(t, uint8(0xFF), table.Tail)
+
+	// the pointees are read forwards from streams once the value has
+	// been read, and the following value starts after the pointees
+	data := append(append([]byte(nil), testSectionTableBytes...), testSectionTableBytes...)
+	dec := NewDecoder(bytes.NewReader(data))
+	for i := 0; i < 2; i++ {
+		table = testSectionTable{}
+		assert.NoError(t, dec.Decode(&table))
+		assert.Equal(t, &testSection{3, 4}, table.Sections[2])
+	}
+}
+
+func TestPointersRelative(t *testing.T) {
+	type node struct {
+		Value uint8
+		Next  *uint8 `binstruct:"ptr=uint8,rel=self"`
+	}
+	value := struct {
+		Pad   uint8
+		Inner struct {
+			A *uint8 `binstruct:"ptr=uint8,rel=parent"`
+			B *node  `binstruct:"ptr=uint8,rel=self"`
+		}
+	}{}
+	a, next := uint8(7), uint8(9)
+	value.Inner.A = &a
+	value.Inner.B = &node{8, &next}
+	b, err := Marshal(&value)
+	assert.NoError(t, err)
+	// A is relative to Inner at 1, B to itself at 2, and Next to
+	// itself at 5
+	assert.Equal(t, []byte{0, 2, 2, 7, 8, 1, 9}, b)
+
+	value.Inner.A, value.Inner.B = nil, nil
+	assert.NoError(t, Unmarshal(b, &value))
+	assert.Equal(t, uint8(7), *value.Inner.A)
+	assert.Equal(t, uint8(8), value.Inner.B.Value)
+	assert.Equal(t, uint8(9), *value.Inner.B.Next)
+}
+
+func TestPointerArray(t *testing.T) {
+	one, two := uint16(1), uint16(2)
+	value := struct {
+		Table [3]*uint16 `binstruct:"ptr=uint8,endian=big"`
+	}{[3]*uint16{&one, nil, &two}}
+	b, err := Marshal(&value)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3, 0, 5, 0, 1, 0, 2}, b)
+
+	value.Table = [3]*uint16{}
+	assert.NoError(t, Unmarshal(b, &value))
+	assert.Equal(t, [3]*uint16{&one, nil, &two}, value.Table)
+}
+
+func TestPointerOverflow(t *testing.T) {
+	value := struct {
+		Data [255]byte
+		Ptr  *uint8 `binstruct:"ptr=uint8"`
+	}{Ptr: new(uint8)}
+	_, err := Marshal(&value)
+	assert.Equal(t, ErrPointerOverflow, errors.Cause(err))
+}
+
+func TestUnmarshalPointerOutOfRange(t *testing.T) {
+	value := struct {
+		Ptr *uint16 `binstruct:"ptr=uint8"`
+	}{}
+	err := Unmarshal([]byte{1, 0}, &value)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+}
+
+func TestPointerInvalid(t *testing.T) {
+	for _, v := range []interface{}{
+		&struct {
+			A *uint8 `binstruct:"ptr=varint"`
+		}{},
+		&struct {
+			A uint8 `binstruct:"ptr=uint8"`
+		}{},
+		&struct {
+			A []uint8 `binstruct:"ptr=uint8,len=1"`
+		}{},
+		&struct {
+			A []*uint8 `binstruct:"ptr=uint8,len=rest"`
+		}{},
+	} {
+		_, err := Marshal(v)
+		assert.Equal(t, ErrOptionPtrInvalid, errors.Cause(err))
+	}
+	_, err := Marshal(&struct {
+		A *uint8 `binstruct:"ptr=uint8,rel=end"`
+	}{})
+	assert.Equal(t, ErrOptionRelInvalid, errors.Cause(err))
+}
+
+type linkedNode struct {
+	Value uint8
+	Next  *linkedNode `binstruct:"ptr=uint8"`
+}
+
+func TestPointersRecursive(t *testing.T) {
+	list := linkedNode{1, &linkedNode{2, &linkedNode{3, nil}}}
+	b, err := Marshal(&list)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 2, 4, 3, 0}, b)
+
+	list = linkedNode{}
+	assert.NoError(t, Unmarshal(b, &list))
+	assert.Equal(t, linkedNode{1, &linkedNode{2, &linkedNode{3, nil}}}, list)
+}
+
+func TestMarshalNilRecursive(t *testing.T) {
+	type node struct {
+		Value uint8
+		Next  *node
+	}
+	_, err := Marshal(node{Value: 1})
+	assert.Equal(t, ErrNilRecursive, errors.Cause(err))
+
+	_, err = Marshal(&struct {
+		Nodes [2]*node
+	}{})
+	assert.Equal(t, ErrNilRecursive, errors.Cause(err))
+
+	// conditional fields end the recursion
+	type conditional struct {
+		More uint8
+		Next *conditional `binstruct:"if=More==1"`
+	}
+	b, err := Marshal(conditional{1, &conditional{}})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0}, b)
+}
+
+func TestPointersRelocated(t *testing.T) {
+	// pointers deferred within the elements follow them when the slice
+	// outgrows its capacity
+	type entry struct {
+		Pad   uint8
+		Inner [2]struct {
+			Value *uint8 `binstruct:"ptr=uint8"`
+		}
+	}
+	d := newDecoder(byteSource{})
+	slice := d.appendElement(reflect.MakeSlice(reflect.TypeOf([]entry{}), 0, 1))
+	d.pointers = []*pointer{{v: slice.Index(0).Field(1).Index(1).Field(0)}}
+	grown := d.appendElement(slice)
+	assert.Equal(t, 2, grown.Len())
+
+	value := uint8(7)
+	d.pointers[0].v.Set(reflect.ValueOf(&value))
+	assert.Equal(t, &value, grown.Index(0).Interface().(entry).Inner[1].Value)
+	assert.Nil(t, slice.Index(0).Interface().(entry).Inner[1].Value)
+}
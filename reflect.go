@@ -10,10 +10,129 @@ func resolveType(value interface{}) reflect.Type {
 
 // underlyingType resolves the underlying type by iterating through
 // the current and parent types until a kind is found which is not a
-// pointer of interface.
+// pointer. Interface types have no element type so are resolved as
+// themselves, the dynamic type of interface values is resolved by
+// reflect.TypeOf.
 func underlyingType(t reflect.Type) reflect.Type {
-	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+	for t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 	return t
 }
+
+// elementType resolves the underlying type of the elements of
+// slices and arrays, any other type is resolved as itself.
+func elementType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = underlyingType(t.Elem())
+	}
+	return t
+}
+
+// indirect follows pointers until a non-pointer value is found,
+// allocating any nil pointers along the way.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// intValue returns the value of an integer or unsigned integer
+// value as an int64, following any pointers.
+func intValue(v reflect.Value) int64 {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return 0
+}
+
+// setIntValue sets the value of an integer or unsigned integer
+// value, pointers are replaced rather than written through so the
+// value they previously pointed to is left unmodified.
+func setIntValue(v reflect.Value, value int64) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		setIntValue(p.Elem(), value)
+		v.Set(p)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(value))
+	}
+}
+
+// dereference follows pointers until a non-pointer value is found,
+// nil pointers are resolved as the zero value of the pointed type.
+func dereference(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Zero(underlyingType(v.Type()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// isNilPointer determines whether the value is, or points to, a nil
+// pointer.
+func isNilPointer(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	return false
+}
+
+// kindSize returns the number of bytes used to represent values
+// of the fixed-size kind, or zero for any other kind. Platform
+// dependent integers are always represented with 8 bytes.
+func kindSize(k reflect.Kind) int {
+	switch k {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int, reflect.Uint, reflect.Int64, reflect.Uint64, reflect.Float64:
+		return 8
+	}
+	return 0
+}
+
+// isInteger determines whether the kind is a signed or unsigned integer.
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// fieldValue returns the value of the struct's field. Unexported and
+// blank fields can't be set or read, so a zero value of their type is
+// returned instead, which skips their bytes when reading and zeroes
+// them when writing.
+func fieldValue(f *fieldDefinition, parent reflect.Value) reflect.Value {
+	if f.Field.PkgPath != "" {
+		return reflect.New(f.Field.Type).Elem()
+	}
+	return parent.FieldByIndex(f.Field.Index)
+}
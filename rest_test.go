@@ -0,0 +1,80 @@
+package binstruct
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalRest(t *testing.T) {
+	type entry struct {
+		X uint8
+		Y uint16
+	}
+	blob := struct {
+		A uint8
+		B []byte `binstruct:"len=rest"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{1, 2, 3, 4}, &blob))
+	assert.Equal(t, []byte{2, 3, 4}, blob.B)
+
+	assert.NoError(t, NewDecoder(bytes.NewReader([]byte{1, 2, 3})).Decode(&blob))
+	assert.Equal(t, []byte{2, 3}, blob.B)
+
+	text := struct {
+		A string `binstruct:"len=rest"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte("abc"), &text))
+	assert.Equal(t, "abc", text.A)
+
+	entries := struct {
+		A []entry `binstruct:"len=rest"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{1, 2, 0, 3, 4, 0}, &entries))
+	assert.Equal(t, []entry{{1, 2}, {3, 4}}, entries.A)
+
+	// the remaining bytes must hold whole elements
+	err := Unmarshal([]byte{1, 2, 0, 3}, &entries)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+
+	custom := struct {
+		A reversedBytes `binstruct:"len=rest"`
+	}{}
+	assert.NoError(t, Unmarshal([]byte{1, 2, 3}, &custom))
+	assert.Equal(t, reversedBytes{3, 2, 1}, custom.A)
+}
+
+func TestMarshalRest(t *testing.T) {
+	foo := struct {
+		A string        `binstruct:"len=rest"`
+		B []uint16      `binstruct:"len=rest"`
+		C reversedBytes `binstruct:"len=rest"`
+	}{"ab", []uint16{1}, reversedBytes{2, 3}}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{'a', 'b', 1, 0, 3, 2}, data)
+}
+
+func TestRestErrors(t *testing.T) {
+	number := struct {
+		A uint32 `binstruct:"len=rest"`
+	}{}
+	_, err := Marshal(number)
+	assert.Equal(t, ErrOptionLenRestInvalid, errors.Cause(err))
+
+	withLenField := struct {
+		N uint8
+		A []byte `binstruct:"len=rest,lenfield=N"`
+	}{}
+	_, err = Marshal(withLenField)
+	assert.Equal(t, ErrOptionLenRestInvalid, errors.Cause(err))
+
+	prefixed := struct {
+		A []byte `binstruct:"len=rest,lenprefix=uint8"`
+	}{}
+	_, err = Marshal(prefixed)
+	assert.Equal(t, ErrOptionLenPrefixInvalid, errors.Cause(err))
+}
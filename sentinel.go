@@ -0,0 +1,131 @@
+package binstruct
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrOptionUntilInvalid = errors.New("tag option until must be an integer, or a condition for slices of structs, used with slices without len, lenfield or lenprefix")
+	ErrSentinelElement    = errors.New("slice element matches the sentinel")
+	ErrSentinelUnknown    = errors.New("sentinel element cannot be created from the until condition")
+)
+
+// sentinel is the element terminating a slice, either an integer
+// value or a condition met by a field of a struct element, such
+// as Type==0xFF.
+type sentinel struct {
+	Value     int64
+	Condition *condition
+}
+
+// parseSentinel parses the until option of the slice field.
+func parseSentinel(f *fieldDefinition) (*sentinel, error) {
+	options := f.Options
+	if f.Type.Kind() != reflect.Slice || options.Len != 0 || options.LenField != "" || options.LenPrefix != "" {
+		return nil, ErrOptionUntilInvalid
+	}
+	t := underlyingType(f.Type.Elem())
+	if t.Kind() == reflect.Struct {
+		c, err := parseCondition(options.Until)
+		if err != nil {
+			return nil, ErrOptionUntilInvalid
+		}
+		definition, err := f.Struct.nestedStructType(t)
+		if err != nil {
+			return nil, err
+		}
+		kinds := append([]reflect.Kind{reflect.Bool}, numericalFieldKinds...)
+		if !definition.HasFieldWithKind(c.Field, kinds...) {
+			return nil, &fieldReferenceError{"until", c.Field, ErrOptionUntilInvalid}
+		}
+		return &sentinel{Condition: c}, nil
+	}
+	if !isInteger(t.Kind()) {
+		return nil, ErrOptionUntilInvalid
+	}
+	value, err := strconv.ParseInt(options.Until, 0, 64)
+	if err != nil {
+		// allow the full range of unsigned 64-bit values
+		u, uerr := strconv.ParseUint(options.Until, 0, 64)
+		if uerr != nil {
+			return nil, ErrOptionUntilInvalid
+		}
+		value = int64(u)
+	}
+	return &sentinel{Value: value}, nil
+}
+
+// Matches determines whether the element is the sentinel.
+func (s *sentinel) Matches(v reflect.Value) bool {
+	v = dereference(v)
+	if s.Condition != nil {
+		return s.Condition.Evaluate(v)
+	}
+	return intValue(v) == s.Value
+}
+
+// Element creates the sentinel element of the type.
+func (s *sentinel) Element(t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if s.Condition == nil {
+		setIntValue(v, s.Value)
+		return v, nil
+	}
+	field := indirect(v).FieldByName(s.Condition.Field)
+	if field.Kind() == reflect.Bool {
+		field.SetBool(s.Condition.Value != 0)
+	} else {
+		setIntValue(field, s.Condition.Value)
+	}
+	// conditions such as Type!=0 don't describe a single value
+	if !s.Matches(v) {
+		return v, ErrSentinelUnknown
+	}
+	return v, nil
+}
+
+// decodeSliceUntil decodes elements until the field's sentinel is
+// read, if any, or no bytes remain. The sentinel isn't included in
+// the slice.
+func (d *decoder) decodeSliceUntil(f *fieldDefinition, v reflect.Value) error {
+	slice := reflect.MakeSlice(v.Type(), 0, 0)
+	for i := 0; ; i++ {
+		end, err := d.atEnd()
+		if err != nil {
+			return err
+		}
+		if end {
+			break
+		}
+		element := reflect.New(v.Type().Elem()).Elem()
+		if err := d.decodeElement(f, element); err != nil {
+			return d.fieldError(err, indexName(i))
+		}
+		if f.Sentinel != nil && f.Sentinel.Matches(element) {
+			break
+		}
+		slice = reflect.Append(slice, element)
+	}
+	v.Set(slice)
+	return nil
+}
+
+// encodeSliceUntil encodes the elements followed by the sentinel.
+func (e *encoder) encodeSliceUntil(f *fieldDefinition, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if f.Sentinel.Matches(v.Index(i)) {
+			return e.fieldError(ErrSentinelElement, indexName(i))
+		}
+	}
+	if err := e.encodeElements(f, v); err != nil {
+		return err
+	}
+	element, err := f.Sentinel.Element(v.Type().Elem())
+	if err != nil {
+		return err
+	}
+	return e.encodeElement(f, element)
+}
@@ -0,0 +1,107 @@
+package binstruct
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentinelEntry struct {
+	Type  uint8
+	Value uint8
+}
+
+type sentinelSlices struct {
+	A []uint16        `binstruct:"until=0xFFFF"`
+	B []int8          `binstruct:"until=0"`
+	C []sentinelEntry `binstruct:"until=Type==0xFF"`
+	D []byte          `binstruct:"until=0"`
+}
+
+var sentinelSlicesData = []byte{
+	1, 0, 2, 0, 0xFF, 0xFF,
+	0xFF, 0,
+	1, 2, 3, 4, 0xFF, 0,
+	'a', 'b', 0,
+}
+
+func TestUnmarshalSentinelSlices(t *testing.T) {
+	var foo sentinelSlices
+	assert.NoError(t, Unmarshal(sentinelSlicesData, &foo))
+	assert.Equal(t, sentinelSlices{
+		A: []uint16{1, 2},
+		B: []int8{-1},
+		C: []sentinelEntry{{1, 2}, {3, 4}},
+		D: []byte("ab"),
+	}, foo)
+
+	// the sentinel may be omitted once no bytes remain
+	assert.NoError(t, Unmarshal(sentinelSlicesData[:16], &foo))
+	assert.Equal(t, []byte("ab"), foo.D)
+
+	dec := NewDecoder(bytes.NewReader(sentinelSlicesData[:15]))
+	assert.NoError(t, dec.Decode(&foo))
+	assert.Equal(t, []byte("a"), foo.D)
+}
+
+func TestMarshalSentinelSlices(t *testing.T) {
+	foo := sentinelSlices{
+		A: []uint16{1, 2},
+		B: []int8{-1},
+		C: []sentinelEntry{{1, 2}, {3, 4}},
+		D: []byte("ab"),
+	}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, sentinelSlicesData, data)
+}
+
+func TestSentinelUint64(t *testing.T) {
+	// hex and decimal sentinels cover the unsigned 64-bit range
+	foo := struct {
+		A []uint64 `binstruct:"until=0xFFFFFFFFFFFFFFFF"`
+		B []uint64 `binstruct:"until=18446744073709551615"`
+	}{[]uint64{1}, []uint64{2}}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Len(t, data, 32)
+
+	foo.A, foo.B = nil, nil
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, []uint64{1}, foo.A)
+	assert.Equal(t, []uint64{2}, foo.B)
+}
+
+func TestSentinelErrors(t *testing.T) {
+	element := struct {
+		A []uint8 `binstruct:"until=0"`
+	}{[]uint8{1, 0}}
+	_, err := Marshal(element)
+	assert.Equal(t, ErrSentinelElement, errors.Cause(err))
+
+	unknown := struct {
+		A []sentinelEntry `binstruct:"until=Type!=0"`
+	}{}
+	_, err = Marshal(unknown)
+	assert.Equal(t, ErrSentinelUnknown, errors.Cause(err))
+
+	withLen := struct {
+		A []uint8 `binstruct:"until=0,len=2"`
+	}{}
+	_, err = Marshal(withLen)
+	assert.Equal(t, ErrOptionUntilInvalid, errors.Cause(err))
+
+	missing := struct {
+		A []sentinelEntry `binstruct:"until=Kind==1"`
+	}{}
+	_, err = Marshal(missing)
+	assert.Equal(t, ErrOptionUntilInvalid, errors.Cause(err))
+
+	notInteger := struct {
+		A []uint8 `binstruct:"until=end"`
+	}{}
+	_, err = Marshal(notInteger)
+	assert.Equal(t, ErrOptionUntilInvalid, errors.Cause(err))
+}
@@ -0,0 +1,125 @@
+package binstruct
+
+import "io"
+
+// sink receives the bytes written by the encoder, positions are
+// relative to the start of the value being encoded.
+type sink interface {
+	// writeAt writes the bytes at the position, any gap between the
+	// end of the written bytes and the position is filled with null
+	// bytes.
+	writeAt(pos int64, b []byte) error
+	// readBack returns the n bytes previously written at the position.
+	readBack(pos int64, n int64) ([]byte, error)
+}
+
+// bufferSink writes to an in-memory byte slice.
+type bufferSink struct {
+	buf []byte
+}
+
+func (s *bufferSink) writeAt(pos int64, b []byte) error {
+	end := pos + int64(len(b))
+	if end > int64(len(s.buf)) {
+		s.buf = append(s.buf, make([]byte, end-int64(len(s.buf)))...)
+	}
+	copy(s.buf[pos:], b)
+	return nil
+}
+
+func (s *bufferSink) readBack(pos int64, n int64) ([]byte, error) {
+	b := make([]byte, n)
+	copy(b, s.buf[pos:pos+n])
+	return b, nil
+}
+
+// seekSink writes directly to a stream, seeking to each position.
+type seekSink struct {
+	w io.WriteSeeker
+	// base is the position in the stream of the value being encoded.
+	base int64
+	// pos is the current position relative to the base.
+	pos int64
+	// end is the number of bytes written relative to the base.
+	end int64
+}
+
+// newSeekSink creates a sink which writes from the current position
+// of the stream.
+func newSeekSink(w io.WriteSeeker) (*seekSink, error) {
+	base, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return &seekSink{w: w, base: base}, nil
+}
+
+func (s *seekSink) writeAt(pos int64, b []byte) error {
+	if pos > s.end {
+		// fill the gap rather than relying on the stream to do so
+		if err := s.seek(s.end); err != nil {
+			return err
+		}
+		if err := s.writeBytes(make([]byte, pos-s.end)); err != nil {
+			return err
+		}
+	}
+	if err := s.seek(pos); err != nil {
+		return err
+	}
+	return s.writeBytes(b)
+}
+
+// readBack reads the written bytes from the stream, which must also
+// implement io.ReaderAt.
+func (s *seekSink) readBack(pos int64, n int64) ([]byte, error) {
+	r, ok := s.w.(io.ReaderAt)
+	if !ok {
+		return nil, ErrChecksumUnreadable
+	}
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, s.base+pos); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// seek moves the stream to the position relative to the base.
+func (s *seekSink) seek(pos int64) error {
+	if pos == s.pos {
+		return nil
+	}
+	if _, err := s.w.Seek(s.base+pos, io.SeekStart); err != nil {
+		return err
+	}
+	s.pos = pos
+	return nil
+}
+
+// writeBytes writes the bytes at the current position.
+func (s *seekSink) writeBytes(b []byte) error {
+	n, err := s.w.Write(b)
+	s.pos += int64(n)
+	if s.pos > s.end {
+		s.end = s.pos
+	}
+	return err
+}
+
+// close moves the stream to the end of the written bytes, so any
+// further writes follow the encoded value.
+func (s *seekSink) close() error {
+	return s.seek(s.end)
+}
+
+// discardSink drops the written bytes, and is used to measure the
+// size of encoded values.
+type discardSink struct{}
+
+func (discardSink) writeAt(pos int64, b []byte) error {
+	return nil
+}
+
+func (discardSink) readBack(pos int64, n int64) ([]byte, error) {
+	return make([]byte, n), nil
+}
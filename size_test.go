@@ -0,0 +1,92 @@
+package binstruct
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type sizedBody struct {
+	A uint8
+	B uint16
+}
+
+type sizedChunk struct {
+	ID   [4]byte
+	Size uint32
+	Body sizedBody `binstruct:"sizefield=Size"`
+	Next uint8
+}
+
+func TestUnmarshalSizeField(t *testing.T) {
+	// the unknown trailing bytes of the body are skipped
+	data := []byte{'R', 'I', 'F', 'F', 5, 0, 0, 0, 1, 2, 0, 0xAA, 0xBB, 9}
+	var chunk sizedChunk
+	assert.NoError(t, Unmarshal(data, &chunk))
+	assert.Equal(t, sizedBody{1, 2}, chunk.Body)
+	assert.Equal(t, uint8(9), chunk.Next)
+
+	chunk = sizedChunk{}
+	assert.NoError(t, NewDecoder(bytes.NewReader(data)).Decode(&chunk))
+	assert.Equal(t, sizedBody{1, 2}, chunk.Body)
+	assert.Equal(t, uint8(9), chunk.Next)
+
+	// the remaining bytes are those of the bounded region
+	rest := struct {
+		N    uint8
+		Body struct {
+			A    uint8
+			Data []byte `binstruct:"len=rest"`
+		} `binstruct:"sizefield=N"`
+		Next uint8
+	}{}
+	assert.NoError(t, Unmarshal([]byte{3, 1, 2, 3, 4}, &rest))
+	assert.Equal(t, []byte{2, 3}, rest.Body.Data)
+	assert.Equal(t, uint8(4), rest.Next)
+}
+
+func TestUnmarshalSizeFieldOverrun(t *testing.T) {
+	data := []byte{'R', 'I', 'F', 'F', 2, 0, 0, 0, 1, 2, 0, 9}
+	var chunk sizedChunk
+	err := Unmarshal(data, &chunk)
+	assert.Equal(t, ErrSizeExceeded, errors.Cause(err))
+	if e, ok := err.(*FieldError); assert.True(t, ok) {
+		assert.Equal(t, "Body.B", e.Path)
+		assert.Equal(t, int64(9), e.Offset)
+		assert.Equal(t, int64(2), e.Expected)
+		assert.Equal(t, int64(1), e.Available)
+	}
+
+	// nested regions can't exceed the enclosing region
+	nested := struct {
+		N     uint8
+		Outer struct {
+			M     uint8
+			Inner sizedBody `binstruct:"sizefield=M"`
+		} `binstruct:"sizefield=N"`
+	}{}
+	err = Unmarshal([]byte{2, 3, 1, 2, 0}, &nested)
+	assert.Equal(t, ErrSizeExceeded, errors.Cause(err))
+}
+
+func TestMarshalSizeField(t *testing.T) {
+	chunk := sizedChunk{ID: [4]byte{'R', 'I', 'F', 'F'}, Body: sizedBody{1, 2}, Next: 9}
+	data, err := Marshal(chunk)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{'R', 'I', 'F', 'F', 3, 0, 0, 0, 1, 2, 0, 9}, data)
+
+	invalid := struct {
+		N uint8
+		A uint32 `binstruct:"sizefield=N"`
+	}{}
+	_, err = Marshal(invalid)
+	assert.Equal(t, ErrOptionSizeFieldInvalid, errors.Cause(err))
+
+	missing := struct {
+		A sizedBody `binstruct:"sizefield=N"`
+	}{}
+	_, err = Marshal(missing)
+	assert.Equal(t, ErrOptionSizeFieldInvalid, errors.Cause(err))
+}
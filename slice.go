@@ -0,0 +1,214 @@
+package binstruct
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type LenPrefix = string
+
+const (
+	// LenPrefixUint8 is a slice with the length determined by a
+	// 1-byte prefix.
+	LenPrefixUint8 LenPrefix = "uint8"
+	// LenPrefixUint16 is a slice with the length determined by a
+	// 2-byte prefix.
+	LenPrefixUint16 LenPrefix = "uint16"
+	// LenPrefixUint32 is a slice with the length determined by a
+	// 4-byte prefix.
+	LenPrefixUint32 LenPrefix = "uint32"
+	// LenPrefixUint64 is a slice with the length determined by a
+	// 8-byte prefix.
+	LenPrefixUint64 LenPrefix = "uint64"
+	// LenPrefixVarint is a slice with the length determined by a
+	// Protocol Buffers varint prefix, the other variable-length
+	// integer types may also be used.
+	LenPrefixVarint LenPrefix = IntVarint
+)
+
+type LenUnit = string
+
+const (
+	// LenUnitCount is a slice length which is the number of elements.
+	LenUnitCount LenUnit = "count"
+	// LenUnitBytes is a slice length which is the total size in bytes
+	// of the elements.
+	LenUnitBytes LenUnit = "bytes"
+)
+
+var (
+	ErrOptionLenPrefixInvalid = errors.New("tag option lenprefix must be an integer type used with slices without len or lenfield")
+	ErrOptionLenUnitInvalid   = errors.New("tag option lenunit must be count or bytes")
+	ErrLenBytesMismatch       = errors.New("slice elements don't match the length in bytes")
+)
+
+// lenPrefixSize returns the number of bytes used by a fixed-size
+// length prefix, or zero if the prefix isn't fixed-size.
+func lenPrefixSize(p LenPrefix) int {
+	switch p {
+	case LenPrefixUint8:
+		return 1
+	case LenPrefixUint16:
+		return 2
+	case LenPrefixUint32:
+		return 4
+	case LenPrefixUint64:
+		return 8
+	}
+	return 0
+}
+
+// makeSlice creates an empty slice with capacity for n elements,
+// limited by the bytes remaining so corrupt or malicious lengths can't
+// allocate more than the data holds. Elements are added by
+// appendElement as they're decoded.
+func (d *decoder) makeSlice(t reflect.Type, n int64) reflect.Value {
+	limit, ok := d.src.remaining(d.pos)
+	if !ok {
+		limit = readChunkSize
+	}
+	if d.end >= 0 && d.end-d.pos < limit {
+		limit = d.end - d.pos
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	if n > limit {
+		n = limit
+	}
+	return reflect.MakeSlice(t, 0, int(n))
+}
+
+// appendElement extends the slice by a zero element to be decoded in
+// place. Deferred pointers within the elements are moved when the
+// slice outgrows its capacity.
+func (d *decoder) appendElement(slice reflect.Value) reflect.Value {
+	if slice.Len() < slice.Cap() {
+		return slice.Slice(0, slice.Len()+1)
+	}
+	grown := reflect.Append(slice, reflect.Zero(slice.Type().Elem()))
+	d.relocatePointers(slice, grown)
+	return grown
+}
+
+// sliceLen returns the length of the slice field, either read from
+// the field's prefix or determined by the Len and LenField options.
+func (d *decoder) sliceLen(f *fieldDefinition, parent reflect.Value) (int64, error) {
+	if f.Options.LenPrefix == "" {
+		return fieldLen(f, parent)
+	}
+	var n int64
+	if isVarint(f.Options.LenPrefix) {
+		value, err := d.readVarint(f.Options.LenPrefix)
+		if err != nil {
+			return 0, err
+		}
+		n = int64(value)
+	} else {
+		value, err := d.readUint(lenPrefixSize(f.Options.LenPrefix))
+		if err != nil {
+			return 0, err
+		}
+		n = int64(value)
+	}
+	if n < 0 {
+		return 0, ErrNegativeLen
+	}
+	return n, nil
+}
+
+// decodeSliceBytes decodes elements until the length in bytes has
+// been read, the final element must end at the length.
+func (d *decoder) decodeSliceBytes(f *fieldDefinition, v reflect.Value, n int64) error {
+	end := d.pos + n
+	slice := reflect.MakeSlice(v.Type(), 0, 0)
+	for i := 0; d.pos < end; i++ {
+		start := d.pos
+		element := reflect.New(v.Type().Elem()).Elem()
+		if err := d.decodeElement(f, element); err != nil {
+			return d.fieldError(err, indexName(i))
+		}
+		if d.pos > end || d.pos == start {
+			return d.fieldError(ErrLenBytesMismatch, indexName(i))
+		}
+		slice = reflect.Append(slice, element)
+	}
+	v.Set(slice)
+	return nil
+}
+
+// encodeSlice writes the slice's prefix, if any, and its elements,
+// fixed-length slices are padded to their length.
+func (e *encoder) encodeSlice(f *fieldDefinition, v reflect.Value) error {
+	options := f.Options
+	if f.Sentinel != nil {
+		return e.encodeSliceUntil(f, v)
+	}
+	if options.Len == LenRest {
+		return e.encodeElements(f, v)
+	}
+	if options.LenPrefix == "" && options.LenField == "" && options.Len == 0 {
+		return ErrLenRequired
+	}
+	fixed := options.LenPrefix == "" && options.LenField == ""
+
+	n := int64(v.Len())
+	if options.LenUnit == LenUnitBytes {
+		// measure the elements before writing them, as the size
+		// of a variable-length prefix depends on the length
+		measure := &encoder{dst: discardSink{}, pos: e.pos, order: e.order}
+		if err := measure.encodeElements(f, v); err != nil {
+			return err
+		}
+		n = measure.pos - e.pos
+	}
+	if fixed && n > options.Len {
+		return ErrLenExceeded
+	}
+	if options.LenPrefix != "" {
+		if err := e.writeLenPrefix(options.LenPrefix, n); err != nil {
+			return err
+		}
+	}
+	if err := e.encodeElements(f, v); err != nil {
+		return err
+	}
+	if !fixed {
+		return nil
+	}
+	if options.LenUnit == LenUnitBytes {
+		// pad the remainder of the fixed size
+		return e.write(make([]byte, options.Len-n))
+	}
+	// pad fixed-length slices with zero-value elements
+	zero := reflect.Zero(v.Type().Elem())
+	for i := n; i < options.Len; i++ {
+		if err := e.encodeElement(f, zero); err != nil {
+			return e.fieldError(err, indexName(int(i)))
+		}
+	}
+	return nil
+}
+
+// encodeElements encodes each of the slice's elements.
+func (e *encoder) encodeElements(f *fieldDefinition, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encodeElement(f, v.Index(i)); err != nil {
+			return e.fieldError(err, indexName(i))
+		}
+	}
+	return nil
+}
+
+// writeLenPrefix writes the slice length using the prefix type.
+func (e *encoder) writeLenPrefix(p LenPrefix, n int64) error {
+	if isVarint(p) {
+		return e.writeVarint(p, uint64(n))
+	}
+	size := lenPrefixSize(p)
+	if size < 8 && uint64(n) >= 1<<uint(size*8) {
+		return ErrLenExceeded
+	}
+	return e.writeUint(size, uint64(n))
+}
@@ -0,0 +1,107 @@
+package binstruct
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type prefixedSlices struct {
+	A []uint16  `binstruct:"lenprefix=uint8"`
+	B []uint16  `binstruct:"lenprefix=uint16,lenunit=bytes"`
+	C []uvarint `binstruct:"lenprefix=varint,lenunit=bytes"`
+	D []byte    `binstruct:"lenprefix=uint32"`
+	N uint8
+	E []uint32 `binstruct:"lenfield=N,lenunit=bytes"`
+}
+
+var prefixedSlicesData = []byte{
+	2, 1, 0, 2, 0,
+	4, 0, 3, 0, 4, 0,
+	3, 0x01, 0xAC, 0x02,
+	1, 0, 0, 0, 9,
+	8, 5, 0, 0, 0, 6, 0, 0, 0,
+}
+
+func TestUnmarshalPrefixedSlices(t *testing.T) {
+	var foo prefixedSlices
+	assert.NoError(t, Unmarshal(prefixedSlicesData, &foo))
+	assert.Equal(t, prefixedSlices{
+		A: []uint16{1, 2},
+		B: []uint16{3, 4},
+		C: []uvarint{1, 300},
+		D: []byte{9},
+		N: 8,
+		E: []uint32{5, 6},
+	}, foo)
+}
+
+func TestMarshalPrefixedSlices(t *testing.T) {
+	foo := prefixedSlices{
+		A: []uint16{1, 2},
+		B: []uint16{3, 4},
+		C: []uvarint{1, 300},
+		D: []byte{9},
+		E: []uint32{5, 6},
+	}
+	data, err := Marshal(foo)
+	assert.NoError(t, err)
+	assert.Equal(t, prefixedSlicesData, data)
+
+	fixed := struct {
+		A []uint16 `binstruct:"len=6,lenunit=bytes"`
+	}{[]uint16{1, 2}}
+	data, err = Marshal(fixed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0, 2, 0, 0, 0}, data)
+}
+
+func TestPrefixedSliceErrors(t *testing.T) {
+	// the final element overruns the length in bytes
+	odd := struct {
+		A []uint16 `binstruct:"lenprefix=uint8,lenunit=bytes"`
+	}{}
+	err := Unmarshal([]byte{3, 1, 0, 2, 0}, &odd)
+	assert.Equal(t, ErrLenBytesMismatch, errors.Cause(err))
+
+	long := struct {
+		A []byte `binstruct:"lenprefix=uint8"`
+	}{make([]byte, 256)}
+	_, err = Marshal(long)
+	assert.Equal(t, ErrLenExceeded, errors.Cause(err))
+
+	withLen := struct {
+		A []byte `binstruct:"lenprefix=uint8,len=2"`
+	}{}
+	_, err = Marshal(withLen)
+	assert.Equal(t, ErrOptionLenPrefixInvalid, errors.Cause(err))
+
+	notSlice := struct {
+		A string `binstruct:"lenprefix=uint8"`
+	}{}
+	_, err = Marshal(notSlice)
+	assert.Equal(t, ErrOptionLenPrefixInvalid, errors.Cause(err))
+
+	unit := struct {
+		A []byte `binstruct:"len=1,lenunit=words"`
+	}{}
+	_, err = Marshal(unit)
+	assert.Equal(t, ErrOptionLenUnitInvalid, errors.Cause(err))
+}
+
+type treeNode struct {
+	N    uint8
+	Kids []treeNode `binstruct:"lenfield=N"`
+}
+
+func TestSliceRecursive(t *testing.T) {
+	tree := treeNode{Kids: []treeNode{{Kids: []treeNode{{}}}, {}}}
+	data, err := Marshal(&tree)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, 1, 0, 0}, data)
+
+	tree = treeNode{}
+	assert.NoError(t, Unmarshal(data, &tree))
+	assert.Equal(t, treeNode{2, []treeNode{{1, []treeNode{{0, []treeNode{}}}}, {0, []treeNode{}}}}, tree)
+}
@@ -0,0 +1,278 @@
+package binstruct
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSeekBackwards = errors.New("cannot seek backwards within a stream")
+)
+
+// source provides the bytes read by the decoder, positions are
+// relative to the start of the value being decoded.
+type source interface {
+	// readAt returns the n bytes found at the position.
+	readAt(pos int64, n int64) ([]byte, error)
+	// readSome reads up to len(p) bytes at the position, io.EOF is
+	// returned when no bytes remain.
+	readSome(pos int64, p []byte) (int, error)
+	// atEnd determines whether no bytes remain at the position.
+	atEnd(pos int64) (bool, error)
+	// remaining returns the number of bytes which follow the position,
+	// false is returned when the number isn't known.
+	remaining(pos int64) (int64, bool)
+}
+
+// byteSource reads from an in-memory byte slice.
+type byteSource []byte
+
+func (s byteSource) readAt(pos int64, n int64) ([]byte, error) {
+	if pos < 0 || n > int64(len(s))-pos {
+		return nil, eofError(pos, n, int64(len(s))-pos)
+	}
+	return s[pos : pos+n], nil
+}
+
+func (s byteSource) readSome(pos int64, p []byte) (int, error) {
+	if pos >= int64(len(s)) {
+		return 0, io.EOF
+	}
+	return copy(p, s[pos:]), nil
+}
+
+func (s byteSource) atEnd(pos int64) (bool, error) {
+	return pos >= int64(len(s)), nil
+}
+
+func (s byteSource) remaining(pos int64) (int64, bool) {
+	return int64(len(s)) - pos, true
+}
+
+// windowSource reads from bytes copied from a stream, which are
+// positioned as they were in the stream.
+type windowSource struct {
+	b   []byte
+	pos int64
+}
+
+func (s *windowSource) readAt(pos int64, n int64) ([]byte, error) {
+	end := s.pos + int64(len(s.b))
+	if pos < s.pos || n > end-pos {
+		return nil, eofError(pos, n, end-pos)
+	}
+	return s.b[pos-s.pos : pos-s.pos+n], nil
+}
+
+func (s *windowSource) readSome(pos int64, p []byte) (int, error) {
+	if pos < s.pos || pos >= s.pos+int64(len(s.b)) {
+		return 0, io.EOF
+	}
+	return copy(p, s.b[pos-s.pos:]), nil
+}
+
+func (s *windowSource) atEnd(pos int64) (bool, error) {
+	return pos >= s.pos+int64(len(s.b)), nil
+}
+
+func (s *windowSource) remaining(pos int64) (int64, bool) {
+	return s.pos + int64(len(s.b)) - pos, true
+}
+
+// readerSource reads sequentially from a stream, only seeking
+// forwards is possible unless the bytes already read are retained.
+type readerSource struct {
+	r *bufio.Reader
+	// pos is the position of the next byte in the stream.
+	pos int64
+	// retain keeps the bytes read in retained, so they can be read
+	// again by checksums.
+	retain   bool
+	retained []byte
+}
+
+// readChunkSize limits the size of allocations made before the
+// bytes have been read, avoiding large allocations when reading
+// lengths from corrupt or malicious streams.
+const readChunkSize = 64 * 1024
+
+func (s *readerSource) readAt(pos int64, n int64) ([]byte, error) {
+	if pos < s.pos {
+		if !s.retain {
+			return nil, ErrSeekBackwards
+		}
+		return s.readRetained(pos, n)
+	}
+	if pos > s.pos {
+		if err := s.discard(pos - s.pos); err != nil {
+			return nil, s.readError(err, pos, n, 0)
+		}
+	}
+	if n <= readChunkSize {
+		b := make([]byte, n)
+		read, err := io.ReadFull(s.r, b)
+		s.advance(b[:read])
+		if err != nil {
+			return nil, s.readError(err, pos, n, int64(read))
+		}
+		return b, nil
+	}
+	var buf bytes.Buffer
+	read, err := buf.ReadFrom(io.LimitReader(s.r, n))
+	s.advance(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if read < n {
+		return nil, eofError(pos, n, read)
+	}
+	return buf.Bytes(), nil
+}
+
+// readRetained reads bytes before the current position from the
+// retained bytes, reading any which follow from the stream.
+func (s *readerSource) readRetained(pos int64, n int64) ([]byte, error) {
+	if pos < 0 {
+		return nil, eofError(pos, n, 0)
+	}
+	if n > s.pos-pos {
+		if _, err := s.readAt(s.pos, n-(s.pos-pos)); err != nil {
+			return nil, s.readError(err, pos, n, s.pos-pos)
+		}
+	}
+	b := make([]byte, n)
+	copy(b, s.retained[pos:pos+n])
+	return b, nil
+}
+
+// discard skips n bytes of the stream, which are kept when retaining.
+func (s *readerSource) discard(n int64) error {
+	if s.retain {
+		buf := bytes.NewBuffer(s.retained)
+		copied, err := io.CopyN(buf, s.r, n)
+		s.retained = buf.Bytes()
+		s.pos += copied
+		return err
+	}
+	discarded, err := s.r.Discard(int(n))
+	s.pos += int64(discarded)
+	return err
+}
+
+// advance moves the position past the bytes read.
+func (s *readerSource) advance(b []byte) {
+	if s.retain {
+		s.retained = append(s.retained, b...)
+	}
+	s.pos += int64(len(b))
+}
+
+func (s *readerSource) readSome(pos int64, p []byte) (int, error) {
+	if pos < s.pos {
+		return 0, ErrSeekBackwards
+	}
+	if pos > s.pos {
+		if err := s.discard(pos - s.pos); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.r.Read(p)
+	s.advance(p[:n])
+	return n, err
+}
+
+func (s *readerSource) atEnd(pos int64) (bool, error) {
+	if pos < s.pos {
+		return false, ErrSeekBackwards
+	}
+	if pos > s.pos {
+		if err := s.discard(pos - s.pos); err == io.EOF {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	if _, err := s.r.Peek(1); err == io.EOF {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func (s *readerSource) remaining(pos int64) (int64, bool) {
+	return 0, false
+}
+
+// readError converts the end of the stream to io.ErrUnexpectedEOF,
+// as running out of bytes part way through a value is always
+// unexpected.
+func (s *readerSource) readError(err error, pos int64, n int64, available int64) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return eofError(pos, n, available)
+	}
+	return err
+}
+
+// readerAtSource reads from random positions of an io.ReaderAt,
+// positions are absolute to the start of the reader.
+type readerAtSource struct {
+	r    io.ReaderAt
+	size int64
+}
+
+func (s *readerAtSource) readAt(pos int64, n int64) ([]byte, error) {
+	if pos < 0 || n > s.size-pos {
+		return nil, eofError(pos, n, s.size-pos)
+	}
+	b := make([]byte, n)
+	read, err := s.r.ReadAt(b, pos)
+	if int64(read) == n {
+		// ReadAt may return io.EOF alongside the last bytes
+		return b, nil
+	}
+	if err == io.EOF {
+		return nil, eofError(pos, n, int64(read))
+	}
+	return nil, err
+}
+
+func (s *readerAtSource) readSome(pos int64, p []byte) (int, error) {
+	if pos >= s.size {
+		return 0, io.EOF
+	}
+	if remaining := s.size - pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := s.r.ReadAt(p, pos)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (s *readerAtSource) atEnd(pos int64) (bool, error) {
+	return pos >= s.size, nil
+}
+
+func (s *readerAtSource) remaining(pos int64) (int64, bool) {
+	return s.size - pos, true
+}
+
+// sourceReader reads sequentially from the source as an io.Reader.
+type sourceReader struct {
+	src source
+	pos int64
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.src.readSome(r.pos, p)
+	r.pos += int64(n)
+	return n, err
+}
@@ -0,0 +1,145 @@
+package binstruct
+
+import (
+	"bufio"
+	"io"
+)
+
+// A Decoder reads and decodes binary values from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+	// offset is the number of bytes consumed by previous values.
+	offset int64
+}
+
+// NewDecoder returns a new decoder that reads from r.
+//
+// The decoder introduces its own buffering and may read data from
+// r beyond the values requested.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next binary-encoded value from its input and
+// stores it in the struct pointed to by v. Offsets are relative
+// to the start of each value, and as the input is read sequentially
+// fields can't be positioned before the bytes already read.
+//
+// io.EOF is returned when the input is exhausted before the
+// value begins.
+func (dec *Decoder) Decode(v interface{}) error {
+	value, definition, err := unmarshalTarget(v)
+	if err != nil {
+		return err
+	}
+	if _, err := dec.r.Peek(1); err != nil {
+		return err
+	}
+	// the bytes covered by checksums are read again once the
+	// checksum field has been read
+	src := &readerSource{r: dec.r, retain: definition.HasChecksum}
+	d := newDecoder(src)
+	d.base = dec.offset
+	err = d.decode(definition, value)
+	dec.offset += src.pos
+	return err
+}
+
+// An Encoder writes binary values to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+//
+// When w is an io.WriteSeeker each value is written directly, seeking
+// to the positions given by the field options, otherwise each value is
+// buffered in memory before being written.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the binary encoding of the struct v to the stream.
+// Offsets are relative to the start of each value.
+func (enc *Encoder) Encode(v interface{}) error {
+	value, definition, err := marshalTarget(v)
+	if err != nil {
+		return err
+	}
+	// checksums read back the written bytes, which requires the
+	// stream to implement io.ReaderAt
+	_, readable := enc.w.(io.ReaderAt)
+	if w, ok := enc.w.(io.WriteSeeker); ok && (readable || !definition.HasChecksum) {
+		// streams such as pipes implement io.WriteSeeker but fail
+		// to seek, in which case the value is buffered instead
+		if dst, err := newSeekSink(w); err == nil {
+			e := newEncoder(dst)
+			if err := e.encode(definition, value); err != nil {
+				return err
+			}
+			return dst.close()
+		}
+	}
+	dst := &bufferSink{}
+	e := newEncoder(dst)
+	if err := e.encode(definition, value); err != nil {
+		return err
+	}
+	_, err = enc.w.Write(dst.buf)
+	return err
+}
+
+// A ReaderAtDecoder decodes binary values from random positions of an
+// io.ReaderAt, such as a file or memory-mapped region. Offsets are
+// absolute to the start of the reader, and only the bytes belonging to
+// the decoded fields are read.
+type ReaderAtDecoder struct {
+	src *readerAtSource
+	pos int64
+}
+
+// NewReaderAtDecoder returns a new decoder that reads from the first
+// size bytes of r.
+func NewReaderAtDecoder(r io.ReaderAt, size int64) *ReaderAtDecoder {
+	return &ReaderAtDecoder{src: &readerAtSource{r: r, size: size}}
+}
+
+// Decode decodes the value found at the current position and stores it
+// in the struct pointed to by v, the position is advanced to the end of
+// the last field decoded.
+//
+// io.EOF is returned when the reader is exhausted before the value begins.
+func (dec *ReaderAtDecoder) Decode(v interface{}) error {
+	if dec.pos >= dec.src.size {
+		return io.EOF
+	}
+	pos, err := dec.decodeAt(v, dec.pos)
+	if err != nil {
+		return err
+	}
+	dec.pos = pos
+	return nil
+}
+
+// DecodeAt decodes the value found at the absolute position off and
+// stores it in the struct pointed to by v, the current position is
+// unchanged.
+func (dec *ReaderAtDecoder) DecodeAt(v interface{}, off int64) error {
+	_, err := dec.decodeAt(v, off)
+	return err
+}
+
+// decodeAt decodes the value at the position, returning the position
+// following the last field decoded.
+func (dec *ReaderAtDecoder) decodeAt(v interface{}, off int64) (int64, error) {
+	value, definition, err := unmarshalTarget(v)
+	if err != nil {
+		return 0, err
+	}
+	d := newDecoder(dec.src)
+	d.pos = off
+	if err := d.decode(definition, value); err != nil {
+		return 0, err
+	}
+	return d.pos, nil
+}
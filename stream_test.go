@@ -0,0 +1,156 @@
+package binstruct
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoderDecode(t *testing.T) {
+	type record struct {
+		Len  uint8
+		Name string `binstruct:"lenfield=Len"`
+		Tail uint16 `binstruct:"skip=1"`
+	}
+	data := []byte("\x02ab\x00\x01\x00\x03cde\x00\x02\x00")
+	dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(data)))
+
+	var a, b, c record
+	assert.NoError(t, dec.Decode(&a))
+	assert.Equal(t, record{2, "ab", 1}, a)
+	assert.NoError(t, dec.Decode(&b))
+	assert.Equal(t, record{3, "cde", 2}, b)
+	assert.Equal(t, io.EOF, dec.Decode(&c))
+}
+
+func TestDecoderOffsetRelativeToValue(t *testing.T) {
+	type record struct {
+		A uint8
+		B uint8 `binstruct:"offset=2"`
+	}
+	dec := NewDecoder(bytes.NewReader([]byte{1, 0, 2, 3, 0, 4}))
+
+	var a, b record
+	assert.NoError(t, dec.Decode(&a))
+	assert.Equal(t, record{1, 2}, a)
+	assert.NoError(t, dec.Decode(&b))
+	assert.Equal(t, record{3, 4}, b)
+}
+
+func TestDecoderSeekBackwards(t *testing.T) {
+	foo := struct {
+		A uint8
+		B uint8 `binstruct:"skip=-1"`
+	}{}
+	dec := NewDecoder(bytes.NewReader([]byte{1, 2}))
+	err := dec.Decode(&foo)
+	assert.Equal(t, ErrSeekBackwards, errors.Cause(err))
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	foo := struct {
+		A uint32
+		B []byte `binstruct:"len=100000"`
+	}{}
+	dec := NewDecoder(bytes.NewReader([]byte{1, 2}))
+	err := dec.Decode(&foo)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+
+	dec = NewDecoder(bytes.NewReader([]byte{1, 2, 3, 4, 5}))
+	err = dec.Decode(&foo)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+}
+
+func TestEncoderEncode(t *testing.T) {
+	type record struct {
+		Len  uint8
+		Name string `binstruct:"lenfield=Len"`
+		Tail uint16 `binstruct:"skip=1"`
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	assert.NoError(t, enc.Encode(record{Name: "ab", Tail: 1}))
+	assert.NoError(t, enc.Encode(&record{Name: "cde", Tail: 2}))
+	assert.Equal(t, []byte("\x02ab\x00\x01\x00\x03cde\x00\x02\x00"), buf.Bytes())
+}
+
+func TestEncoderWriteSeeker(t *testing.T) {
+	type record struct {
+		Offset uint8
+		A      uint8 `binstruct:"offset=4"`
+		B      uint8 `binstruct:"offsetfield=Offset,skip=1"`
+		C      uint8 `binstruct:"offset=2"`
+	}
+	file, err := os.Create(filepath.Join(t.TempDir(), "records"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+
+	// existing bytes before the values are left untouched
+	_, err = file.Write([]byte{0xFF})
+	assert.NoError(t, err)
+	enc := NewEncoder(file)
+	assert.NoError(t, enc.Encode(record{A: 1, B: 2, C: 3}))
+	assert.NoError(t, enc.Encode(record{A: 4, B: 5, C: 6}))
+
+	expected, err := Marshal(record{A: 1, B: 2, C: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{5, 0, 3, 0, 1, 0, 2}, expected)
+
+	data, err := os.ReadFile(file.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xFF, 5, 0, 3, 0, 1, 0, 2, 5, 0, 6, 0, 4, 0, 5}, data)
+}
+
+func TestReaderAtDecoder(t *testing.T) {
+	type entry struct {
+		Offset uint8
+		Len    uint8
+		Name   string `binstruct:"offsetfield=Offset,lenfield=Len"`
+	}
+	type header struct {
+		Magic [2]byte
+		Count uint8
+	}
+	data := []byte("BS\x02\x09\x03\x0C\x02\x00\x00abcde")
+	dec := NewReaderAtDecoder(bytes.NewReader(data), int64(len(data)))
+
+	var h header
+	assert.NoError(t, dec.Decode(&h))
+	assert.Equal(t, header{[2]byte{'B', 'S'}, 2}, h)
+
+	// the position continues from the end of the name
+	var e entry
+	assert.NoError(t, dec.Decode(&e))
+	assert.Equal(t, entry{9, 3, "abc"}, e)
+	var tail struct {
+		A [2]byte
+	}
+	assert.NoError(t, dec.Decode(&tail))
+	assert.Equal(t, [2]byte{'d', 'e'}, tail.A)
+	assert.Equal(t, io.EOF, dec.Decode(&tail))
+
+	assert.NoError(t, dec.DecodeAt(&e, 5))
+	assert.Equal(t, entry{12, 2, "de"}, e)
+
+	err := dec.DecodeAt(&e, 13)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+}
+
+func TestReaderAtDecoderCorruptLen(t *testing.T) {
+	var foo struct {
+		N uint64
+		B []byte `binstruct:"lenfield=N"`
+	}
+	data := []byte{0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0}
+	dec := NewReaderAtDecoder(bytes.NewReader(data), int64(len(data)))
+	err := dec.Decode(&foo)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+}
@@ -1,6 +1,7 @@
 package binstruct
 
 import (
+	"encoding/hex"
 	"reflect"
 	"strconv"
 	"strings"
@@ -10,11 +11,23 @@ import (
 
 type tag map[string]interface{}
 
+// hexLiteral is a tag value such as 0x89504E47, which is either an
+// integer or a sequence of bytes depending on the option.
+type hexLiteral string
+
+// literalOptions are the options whose values are kept as written
+// rather than parsed, such as the fixed-point format 2.30 which would
+// lose its trailing zero as a number.
+var literalOptions = map[string]bool{
+	"fixed": true,
+}
+
 var (
 	ErrInvalidTagInt64   = errors.New("expected tag value to be a parsable int64")
 	ErrInvalidTagFloat64 = errors.New("expected tag value to be a parsable float64")
 	ErrInvalidTagString  = errors.New("expected tag value to be a parsable string")
 	ErrInvalidTagBool    = errors.New("expected tag value to be a parsable boolean")
+	ErrInvalidTagLiteral = errors.New("expected tag value to be a parsable integer, hex or string literal")
 )
 
 func parseTag(t reflect.StructTag) tag {
@@ -25,9 +38,13 @@ func parseTag(t reflect.StructTag) tag {
 		for _, key := range keys {
 			if key != "" {
 				if separator := strings.Index(key, "="); separator >= 0 {
-					value := parseTagValue(key[separator+1:])
+					literal := key[separator+1:]
 					key = key[0:separator]
-					result[key] = value
+					if literalOptions[key] {
+						result[key] = literal
+					} else {
+						result[key] = parseTagValue(literal)
+					}
 				} else {
 					result[key] = true
 				}
@@ -49,15 +66,49 @@ func parseTagValue(literal string) interface{} {
 			return value
 		}
 	}
+	if isHexLiteral(literal) {
+		return hexLiteral(literal)
+	}
 	if value, err := strconv.ParseInt(literal, 0, 64); err == nil {
 		return value
 	}
 	return literal
 }
 
+// isHexLiteral determines whether the literal is 0x followed by one
+// or more hex digits.
+func isHexLiteral(literal string) bool {
+	if len(literal) < 3 || literal[0] != '0' || literal[1] != 'x' && literal[1] != 'X' {
+		return false
+	}
+	for _, c := range literal[2:] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseBytesLiteral returns the bytes of a hex literal with an even
+// number of digits, or the bytes of any other literal as written.
+func parseBytesLiteral(literal string) []byte {
+	if isHexLiteral(literal) && len(literal)%2 == 0 {
+		b, _ := hex.DecodeString(literal[2:])
+		return b
+	}
+	return []byte(literal)
+}
+
 func (t tag) Int64(key string) (int64, error) {
 	value, ok := t[key]
 	if ok {
+		if literal, ok := value.(hexLiteral); ok {
+			option, err := strconv.ParseInt(string(literal), 0, 64)
+			if err != nil {
+				return 0, ErrInvalidTagInt64
+			}
+			return option, nil
+		}
 		option, ok := value.(int64)
 		if !ok {
 			return 0, ErrInvalidTagInt64
@@ -91,6 +142,22 @@ func (t tag) String(key string) (string, error) {
 	return "", nil
 }
 
+// Literal returns the value as written for integer, hex and string
+// values, the interpretation is left to the option.
+func (t tag) Literal(key string) (string, error) {
+	switch value := t[key].(type) {
+	case nil:
+		return "", nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case hexLiteral:
+		return string(value), nil
+	case string:
+		return value, nil
+	}
+	return "", ErrInvalidTagLiteral
+}
+
 func (t tag) Byte(key string) (byte, error) {
 	value, err := t.String(key)
 	if err != nil {
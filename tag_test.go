@@ -34,6 +34,9 @@ func TestParseTagValue(t *testing.T) {
 	assert.Equal(t, 0.01, parseTagValue("0.01"))
 	assert.Equal(t, "0.", parseTagValue("0."))
 	assert.Equal(t, int64(1), parseTagValue("1"))
+	assert.Equal(t, hexLiteral("0x0F"), parseTagValue("0x0F"))
+	assert.Equal(t, "0x", parseTagValue("0x"))
+	assert.Equal(t, "0xfoo", parseTagValue("0xfoo"))
 	assert.Equal(t, "foo", parseTagValue("foo"))
 }
 
@@ -152,3 +155,43 @@ func TestParseTagMissing(t *testing.T) {
 	assert.Equal(t, "", e)
 	assert.NoError(t, err)
 }
+
+func TestParseTagHexLiteral(t *testing.T) {
+	values := make(tag, 0)
+	values["a"] = hexLiteral("0x00FF")
+	values["b"] = hexLiteral("0x89504E470D0A1A0A")
+
+	a, err := values.Int64("a")
+	assert.Equal(t, int64(255), a)
+	assert.NoError(t, err)
+	_, err = values.Int64("b")
+	assert.Error(t, err)
+	_, err = values.String("a")
+	assert.Error(t, err)
+
+	literal, err := values.Literal("a")
+	assert.Equal(t, "0x00FF", literal)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0xFF}, parseBytesLiteral(literal))
+	assert.Equal(t, []byte("0x00F"), parseBytesLiteral("0x00F"))
+	assert.Equal(t, []byte("MZ"), parseBytesLiteral("MZ"))
+}
+
+func TestParseTagLiteral(t *testing.T) {
+	values := make(tag, 0)
+	values["a"] = int64(-7)
+	values["b"] = "RIFF"
+	values["c"] = true
+
+	a, err := values.Literal("a")
+	assert.Equal(t, "-7", a)
+	assert.NoError(t, err)
+	b, err := values.Literal("b")
+	assert.Equal(t, "RIFF", b)
+	assert.NoError(t, err)
+	_, err = values.Literal("c")
+	assert.Error(t, err)
+	d, err := values.Literal("d")
+	assert.Equal(t, "", d)
+	assert.NoError(t, err)
+}
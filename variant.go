@@ -0,0 +1,166 @@
+package binstruct
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrOptionSwitchInvalid = errors.New("tag option switch must be an integer")
+	ErrSwitchNotInterface  = errors.New("tag option switch can only be used with interface fields")
+	ErrUnknownVariant      = errors.New("no variant is registered for the discriminator value")
+	ErrUnregisteredVariant = errors.New("variant type is not registered for the interface")
+	ErrNilVariant          = errors.New("variant value cannot be nil")
+)
+
+// variantSet maps the discriminator values of an interface to the
+// concrete types of its variants.
+type variantSet struct {
+	types  map[int64]reflect.Type
+	values map[reflect.Type]int64
+}
+
+var variants = struct {
+	sync.RWMutex
+	sets map[reflect.Type]*variantSet
+}{sets: make(map[reflect.Type]*variantSet)}
+
+// RegisterVariant registers the type of v as the variant of an interface
+// used when the discriminator field equals value. iface must be a pointer
+// to the interface type, v may be either a struct or a pointer to a struct
+// and determines which is stored in the interface when unmarshalling.
+//
+//	binstruct.RegisterVariant((*Payload)(nil), 1, Ping{})
+//
+// RegisterVariant panics if the types are invalid, or the value or type
+// is already registered as a different variant of the interface.
+func RegisterVariant(iface interface{}, value int64, v interface{}) {
+	ifaceType := reflect.TypeOf(iface)
+	if ifaceType == nil || ifaceType.Kind() != reflect.Ptr || ifaceType.Elem().Kind() != reflect.Interface {
+		panic("binstruct: RegisterVariant requires a pointer to an interface type")
+	}
+	ifaceType = ifaceType.Elem()
+	t := reflect.TypeOf(v)
+	if t == nil || !t.Implements(ifaceType) {
+		panic(fmt.Sprintf("binstruct: variant type %v does not implement %v", t, ifaceType))
+	}
+
+	variants.Lock()
+	defer variants.Unlock()
+	set, ok := variants.sets[ifaceType]
+	if !ok {
+		set = &variantSet{
+			types:  make(map[int64]reflect.Type),
+			values: make(map[reflect.Type]int64),
+		}
+		variants.sets[ifaceType] = set
+	}
+	if existing, ok := set.types[value]; ok && existing != t {
+		panic(fmt.Sprintf("binstruct: value %d is already registered to %v for %v", value, existing, ifaceType))
+	}
+	if existing, ok := set.values[t]; ok && existing != value {
+		panic(fmt.Sprintf("binstruct: type %v is already registered to value %d for %v", t, existing, ifaceType))
+	}
+	set.types[value] = t
+	set.values[t] = value
+}
+
+// variantType returns the variant type of the interface registered
+// to the discriminator value.
+func variantType(iface reflect.Type, value int64) (reflect.Type, bool) {
+	variants.RLock()
+	defer variants.RUnlock()
+	if set, ok := variants.sets[iface]; ok {
+		t, ok := set.types[value]
+		return t, ok
+	}
+	return nil, false
+}
+
+// variantValue returns the discriminator value registered to the
+// variant type of the interface.
+func variantValue(iface reflect.Type, t reflect.Type) (int64, bool) {
+	variants.RLock()
+	defer variants.RUnlock()
+	if set, ok := variants.sets[iface]; ok {
+		value, ok := set.values[t]
+		return value, ok
+	}
+	return 0, false
+}
+
+// decodeVariant decodes the variant selected by the field's switch
+// sibling and stores it in the interface value.
+func (d *decoder) decodeVariant(f *fieldDefinition, parent reflect.Value, v reflect.Value) error {
+	discriminator := parent.FieldByName(f.Options.Switch)
+	value := intValue(discriminator)
+	t, ok := variantType(v.Type(), value)
+	if !ok {
+		return errors.Wrap(ErrUnknownVariant, "discriminator "+EnumName(dereference(discriminator).Interface()))
+	}
+	variant := reflect.New(underlyingType(t))
+	if err := d.decodeVariantValue(f, variant.Elem()); err != nil {
+		return err
+	}
+	if t.Kind() == reflect.Ptr {
+		v.Set(variant)
+	} else {
+		v.Set(variant.Elem())
+	}
+	return nil
+}
+
+// decodeVariantValue decodes the concrete value of a variant, structs
+// are decoded using the definition of their type.
+func (d *decoder) decodeVariantValue(f *fieldDefinition, v reflect.Value) error {
+	if v.Kind() == reflect.Struct && !implementsUnmarshaler(v.Type()) {
+		definition, err := cachedStructType(v.Type())
+		if err != nil {
+			return err
+		}
+		return d.decodeStruct(definition, v)
+	}
+	return d.decodeElement(f, v)
+}
+
+// encodeVariant encodes the concrete value stored in the interface.
+func (e *encoder) encodeVariant(f *fieldDefinition, v reflect.Value) error {
+	if v.IsNil() {
+		return ErrNilVariant
+	}
+	value := dereference(v.Elem())
+	if value.Kind() == reflect.Struct && !implementsMarshaler(value.Type()) {
+		definition, err := cachedStructType(value.Type())
+		if err != nil {
+			return err
+		}
+		return e.encodeStruct(definition, value)
+	}
+	return e.encodeElement(f, value)
+}
+
+// variantDiscriminator returns the discriminator value of the variant
+// stored in the interface.
+func variantDiscriminator(v reflect.Value) (int64, error) {
+	if v.IsNil() {
+		return 0, ErrNilVariant
+	}
+	t := v.Elem().Type()
+	if value, ok := variantValue(v.Type(), t); ok {
+		return value, nil
+	}
+	// a struct registered by value may be stored by pointer, and
+	// a struct registered by pointer may be stored by value
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	} else {
+		t = reflect.PtrTo(t)
+	}
+	if value, ok := variantValue(v.Type(), t); ok {
+		return value, nil
+	}
+	return 0, ErrUnregisteredVariant
+}
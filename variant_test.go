@@ -0,0 +1,96 @@
+package binstruct
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPayload interface {
+	payload()
+}
+
+type testPing struct {
+	Sequence uint16
+}
+
+func (testPing) payload() {}
+
+type testMessage struct {
+	Len  uint8
+	Text string `binstruct:"lenfield=Len"`
+}
+
+func (*testMessage) payload() {}
+
+type testUnregistered struct{}
+
+func (testUnregistered) payload() {}
+
+func init() {
+	RegisterVariant((*testPayload)(nil), 1, testPing{})
+	RegisterVariant((*testPayload)(nil), 2, &testMessage{})
+}
+
+type testPacket struct {
+	Kind    uint8
+	Payload testPayload `binstruct:"switch=Kind"`
+	Tail    uint8
+}
+
+func TestParseStructSwitch(t *testing.T) {
+	notInterface := struct {
+		Kind    uint8
+		Payload testPing `binstruct:"switch=Kind"`
+	}{}
+	_, err := parseStruct(notInterface)
+	assert.Equal(t, ErrSwitchNotInterface, err)
+
+	missing := struct {
+		Payload testPayload `binstruct:"switch=Kind"`
+	}{}
+	_, err = parseStruct(missing)
+	assert.EqualError(t, err, "cannot use field Kind for switch")
+}
+
+func TestRegisterVariantPanics(t *testing.T) {
+	assert.Panics(t, func() { RegisterVariant(testPing{}, 3, testPing{}) })
+	assert.Panics(t, func() { RegisterVariant((*testPayload)(nil), 3, 1) })
+	assert.Panics(t, func() { RegisterVariant((*testPayload)(nil), 1, &testMessage{}) })
+	assert.Panics(t, func() { RegisterVariant((*testPayload)(nil), 3, testPing{}) })
+	assert.NotPanics(t, func() { RegisterVariant((*testPayload)(nil), 1, testPing{}) })
+}
+
+func TestUnmarshalVariant(t *testing.T) {
+	var packet testPacket
+	assert.NoError(t, Unmarshal([]byte{1, 0x02, 0x01, 9}, &packet))
+	assert.Equal(t, testPacket{1, testPing{0x0102}, 9}, packet)
+
+	assert.NoError(t, Unmarshal([]byte{2, 2, 'h', 'i', 9}, &packet))
+	assert.Equal(t, testPacket{2, &testMessage{2, "hi"}, 9}, packet)
+
+	err := Unmarshal([]byte{3, 0, 0}, &packet)
+	assert.Equal(t, ErrUnknownVariant, errors.Cause(err))
+}
+
+func TestMarshalVariant(t *testing.T) {
+	data, err := Marshal(testPacket{Payload: testPing{0x0102}, Tail: 9})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0x02, 0x01, 9}, data)
+
+	data, err = Marshal(testPacket{Payload: &testMessage{Text: "hi"}, Tail: 9})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, 2, 'h', 'i', 9}, data)
+
+	// variants registered by value may be stored by pointer
+	data, err = Marshal(testPacket{Payload: &testPing{0x0102}, Tail: 9})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0x02, 0x01, 9}, data)
+
+	_, err = Marshal(testPacket{Payload: testUnregistered{}})
+	assert.Equal(t, ErrUnregisteredVariant, errors.Cause(err))
+
+	_, err = Marshal(testPacket{})
+	assert.Equal(t, ErrNilVariant, errors.Cause(err))
+}
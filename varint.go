@@ -0,0 +1,114 @@
+package binstruct
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type IntType = string
+
+const (
+	// IntFixed is an integer using the number of bytes of its type.
+	IntFixed IntType = "fixed"
+	// IntULEB128 is an unsigned LEB128 variable-length integer.
+	IntULEB128 IntType = "uleb128"
+	// IntSLEB128 is a signed LEB128 variable-length integer.
+	IntSLEB128 IntType = "sleb128"
+	// IntVarint is a Protocol Buffers varint, which is encoded as
+	// unsigned LEB128 with negative values using ten bytes.
+	IntVarint IntType = "varint"
+	// IntZigZag is a Protocol Buffers zigzag-encoded varint, which
+	// encodes values of small magnitude using fewer bytes.
+	IntZigZag IntType = "zigzag"
+)
+
+// maxVarintLen is the maximum number of bytes of a 64-bit varint.
+const maxVarintLen = 10
+
+var (
+	ErrOptionIntInvalid = errors.New("tag option int must be an integer encoding used with integer fields")
+	ErrVarintOverflow   = errors.New("variable-length integer overflows the field")
+)
+
+// isVarint determines whether the integer type is a variable-length
+// encoding.
+func isVarint(t IntType) bool {
+	switch t {
+	case IntULEB128, IntSLEB128, IntVarint, IntZigZag:
+		return true
+	}
+	return false
+}
+
+// readVarint reads a variable-length integer, returning the bits of
+// the value which are interpreted as signed or unsigned by the caller.
+func (d *decoder) readVarint(t IntType) (uint64, error) {
+	var value uint64
+	var shift uint
+	for i := 0; ; i++ {
+		if i == maxVarintLen {
+			return 0, ErrVarintOverflow
+		}
+		b, err := d.read(1)
+		if err != nil {
+			return 0, err
+		}
+		// the final byte holds the top bit, and for signed LEB128 the
+		// extension of the sign
+		if i == maxVarintLen-1 && b[0] > 1 && (t != IntSLEB128 || b[0] != 0x7F) {
+			return 0, ErrVarintOverflow
+		}
+		value |= uint64(b[0]&0x7F) << shift
+		shift += 7
+		if b[0] < 0x80 {
+			// extend the sign of the final byte
+			if t == IntSLEB128 && shift < 64 && b[0]&0x40 != 0 {
+				value |= ^uint64(0) << shift
+			}
+			break
+		}
+	}
+	if t == IntZigZag {
+		value = uint64(int64(value>>1) ^ -int64(value&1))
+	}
+	return value, nil
+}
+
+// writeVarint writes the bits of a signed or unsigned value as a
+// variable-length integer.
+func (e *encoder) writeVarint(t IntType, value uint64) error {
+	if t == IntZigZag {
+		value = uint64(int64(value)<<1 ^ int64(value)>>63)
+	}
+	b := make([]byte, 0, maxVarintLen)
+	for {
+		c := byte(value & 0x7F)
+		if t == IntSLEB128 {
+			signed := int64(value) >> 7
+			value = uint64(signed)
+			// the value is complete once the remaining bits match
+			// the sign bit of the current byte
+			if signed == 0 && c&0x40 == 0 || signed == -1 && c&0x40 != 0 {
+				return e.write(append(b, c))
+			}
+		} else {
+			value >>= 7
+			if value == 0 {
+				return e.write(append(b, c))
+			}
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// fitsKind determines whether the bits of a signed or unsigned value
+// can be stored by the integer kind without overflowing.
+func fitsKind(value uint64, kind reflect.Kind) bool {
+	shift := uint(64 - kindSize(kind)*8)
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int64(value<<shift)>>shift == int64(value)
+	}
+	return value<<shift>>shift == value
+}
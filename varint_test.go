@@ -0,0 +1,111 @@
+package binstruct
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type varints struct {
+	A uint32 `binstruct:"int=uleb128"`
+	B int32  `binstruct:"int=sleb128"`
+	C int64  `binstruct:"int=varint"`
+	D int16  `binstruct:"int=zigzag"`
+	E uint64 `binstruct:"int=uleb128"`
+	F int64  `binstruct:"int=sleb128"`
+}
+
+func TestUnmarshalVarint(t *testing.T) {
+	data := []byte{
+		0xE5, 0x8E, 0x26,
+		0xC0, 0xBB, 0x78,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01,
+		0x03,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01,
+		0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x7F,
+	}
+	var foo varints
+	assert.NoError(t, Unmarshal(data, &foo))
+	assert.Equal(t, varints{624485, -123456, -1, -2, 1<<64 - 1, -1 << 63}, foo)
+}
+
+func TestMarshalVarint(t *testing.T) {
+	in := varints{624485, -123456, -1, -2, 1<<64 - 1, -1 << 63}
+	data, err := Marshal(in)
+	assert.NoError(t, err)
+
+	var out varints
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+	assert.Equal(t, []byte{0xE5, 0x8E, 0x26, 0xC0, 0xBB, 0x78}, data[:6])
+	assert.Equal(t, byte(0x03), data[16])
+
+	small := struct {
+		A int64 `binstruct:"int=sleb128"`
+		B int64 `binstruct:"int=zigzag"`
+		C uint8 `binstruct:"int=varint"`
+	}{63, 63, 0}
+	data, err = Marshal(small)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x3F, 0x7E, 0x00}, data)
+}
+
+func TestVarintErrors(t *testing.T) {
+	narrow := struct {
+		A uint8 `binstruct:"int=uleb128"`
+	}{}
+	err := Unmarshal([]byte{0x80, 0x02}, &narrow)
+	assert.Equal(t, ErrVarintOverflow, errors.Cause(err))
+
+	long := struct {
+		A uint64 `binstruct:"int=varint"`
+	}{}
+	data := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02}
+	err = Unmarshal(data, &long)
+	assert.Equal(t, ErrVarintOverflow, errors.Cause(err))
+
+	err = Unmarshal([]byte{0x80, 0x80}, &long)
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+
+	unknown := struct {
+		A uint32 `binstruct:"int=leb"`
+	}{}
+	err = Unmarshal([]byte{0}, &unknown)
+	assert.Equal(t, ErrOptionIntInvalid, errors.Cause(err))
+
+	float := struct {
+		A float32 `binstruct:"int=varint"`
+	}{}
+	_, err = Marshal(float)
+	assert.Equal(t, ErrOptionIntInvalid, errors.Cause(err))
+}
+
+func TestVarintStringPrefix(t *testing.T) {
+	type foo struct {
+		A string `binstruct:"stringtype=uleb128"`
+		B string `binstruct:"stringtype=zigzag"`
+		N uint16 `binstruct:"int=varint"`
+		C []byte `binstruct:"lenfield=N"`
+	}
+	in := foo{A: "abc", B: "de", C: make([]byte, 200)}
+	data, err := Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("\x03abc\x04de\xC8\x01"), data[:9])
+
+	var out foo
+	assert.NoError(t, Unmarshal(data, &out))
+	in.N = 200
+	assert.Equal(t, in, out)
+}
+
+func TestVarintBackfillSize(t *testing.T) {
+	foo := struct {
+		Pad    [200]byte
+		Offset uint32 `binstruct:"int=uleb128"`
+		Data   []byte `binstruct:"len=2,offsetfield=Offset"`
+	}{}
+	_, err := Marshal(foo)
+	assert.Equal(t, ErrBackfillSize, errors.Cause(err))
+}